@@ -0,0 +1,171 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"image"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Asset is the data structure for any non-content file found in a
+// content directory, it gets passed to templates in `Page.Assets`.
+type Asset struct {
+	Path   string // filepath of the source file
+	URL    string // output URL path
+	Size   int64  // size in bytes
+	Type   string // MIME type, detected from the file content
+	Hash   string // hex encoded sha256 sum of the file content
+	Width  int    // width of image & video assets (in pixels)
+	Height int    // height of image & video assets (in pixels)
+	// Duration is the playback length of audio & video assets, it's only
+	// set for the formats pagr can read (mp4/mov/m4a & wav).
+	Duration time.Duration
+
+	Thumbnail string         // output URL path of the thumbnail, if generated
+	Variants  []ImageVariant // resized image variants, see `ImageConfig`
+}
+
+// String returns `a.URL`.
+func (a Asset) String() string {
+	return a.URL
+}
+
+// MediaType returns the top-level type of `a.Type` ("image", "video", etc).
+func (a Asset) MediaType() string {
+	return strings.SplitN(a.Type, "/", 2)[0]
+}
+
+// Srcset returns the value of an <img> "srcset" attribute listing all of
+// the variants of `a` and the original.
+func (a Asset) Srcset() string {
+	var set []string
+	for _, v := range a.Variants {
+		set = append(set, fmt.Sprintf("%s %dw", v.URL, v.Width))
+	}
+	if a.Width > 0 {
+		set = append(set, fmt.Sprintf("%s %dw", a.URL, a.Width))
+	}
+	return strings.Join(set, ", ")
+}
+
+// assetTypes are the MIME types of common asset file extensions that aren't
+// known by the "mime" package on every system, they're registered by `init`.
+var assetTypes = map[string]string{
+	".ico":   "image/x-icon",
+	".bmp":   "image/bmp",
+	".tif":   "image/tiff",
+	".tiff":  "image/tiff",
+	".mp3":   "audio/mpeg",
+	".m4a":   "audio/mp4",
+	".ogg":   "audio/ogg",
+	".oga":   "audio/ogg",
+	".opus":  "audio/opus",
+	".flac":  "audio/flac",
+	".wav":   "audio/wav",
+	".mp4":   "video/mp4",
+	".m4v":   "video/mp4",
+	".mov":   "video/quicktime",
+	".webm":  "video/webm",
+	".mkv":   "video/x-matroska",
+	".ogv":   "video/ogg",
+	".woff":  "font/woff",
+	".woff2": "font/woff2",
+	".ttf":   "font/ttf",
+	".otf":   "font/otf",
+	".txt":   "text/plain; charset=utf-8",
+	".csv":   "text/csv; charset=utf-8",
+	".map":   "application/json",
+	".scss":  "text/x-scss; charset=utf-8",
+	".zip":   "application/zip",
+	".gz":    "application/gzip",
+	".tar":   "application/x-tar",
+	".epub":  "application/epub+zip",
+}
+
+func init() {
+	for ext, t := range assetTypes {
+		if len(mime.TypeByExtension(ext)) == 0 {
+			mime.AddExtensionType(ext, t)
+		}
+	}
+}
+
+// detectType returns the MIME type of `buf` (the first bytes of the file at
+// `fpath`), detected by `http.DetectContentType`. If the detected type is
+// generic, the type for the file extension is used instead (when known).
+func detectType(fpath string, buf []byte) string {
+	mimetype := http.DetectContentType(buf)
+	switch strings.SplitN(mimetype, ";", 2)[0] {
+	case "application/octet-stream", "text/plain", "text/xml", "application/zip":
+		if t := mime.TypeByExtension(filepath.Ext(fpath)); len(t) > 0 {
+			mimetype = t
+		}
+	}
+	return mimetype
+}
+
+// NewAsset returns an `Asset` for the file at `fpath`, with `.URL` set to `url`.
+func NewAsset(fpath, url string) (a Asset, err error) {
+	a.Path = fpath
+	a.URL = url
+
+	var f *os.File
+	if f, err = os.Open(fpath); err != nil {
+		return
+	}
+	defer f.Close()
+
+	head := make([]byte, 512)
+	var n int
+	if n, err = io.ReadFull(f, head); err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return
+	}
+	a.Type = detectType(fpath, head[:n])
+
+	hash := sha256.New()
+	hash.Write(head[:n])
+	var size int64
+	if size, err = io.Copy(hash, f); err != nil {
+		return
+	}
+	a.Size = size + int64(n)
+	a.Hash = hex.EncodeToString(hash.Sum(nil))
+
+	if _, err = f.Seek(0, io.SeekStart); err != nil {
+		return
+	}
+	switch a.MediaType() {
+	case "image":
+		if cfg, _, e := image.DecodeConfig(f); e == nil {
+			a.Width, a.Height = cfg.Width, cfg.Height
+		}
+	case "video", "audio":
+		a.Width, a.Height, a.Duration = readMediaInfo(f, a.Type)
+	}
+	return
+}
+
+func (assets *Assets) classify() {
+	assets.Audio, assets.Image = nil, nil
+	assets.Video, assets.Misc = nil, nil
+	for i := range assets.All {
+		ref := &assets.All[i]
+		switch ref.MediaType() {
+		case "image":
+			assets.Image = append(assets.Image, ref)
+		case "video":
+			assets.Video = append(assets.Video, ref)
+		case "audio":
+			assets.Audio = append(assets.Audio, ref)
+		default:
+			assets.Misc = append(assets.Misc, ref)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// wavData returns the bytes of a 16-bit mono 8kHz WAV file, `seconds` long
+func wavData(seconds int) []byte {
+	var buf bytes.Buffer
+	data := make([]byte, 16000*seconds)
+	le := func(v interface{}) { binary.Write(&buf, binary.LittleEndian, v) }
+	buf.WriteString("RIFF")
+	le(uint32(36 + len(data)))
+	buf.WriteString("WAVEfmt ")
+	le(uint32(16))
+	le([]uint16{1, 1})
+	le([]uint32{8000, 16000})
+	le([]uint16{2, 16})
+	buf.WriteString("data")
+	le(uint32(len(data)))
+	buf.Write(data)
+	return buf.Bytes()
+}
+
+func TestNewAsset(test *testing.T) {
+	test.Parallel()
+
+	tdir := filepath.Join(os.TempDir(), "pagr_test", "TestNewAsset")
+	if err := os.MkdirAll(tdir, 0775); err != nil {
+		test.Errorf("failed to create temporary test dir: %s", tdir)
+	}
+
+	files := map[string][]byte{
+		"image":     asset, // no extension, type is sniffed
+		"audio.wav": wavData(2),
+		"doc.txt":   []byte("text"),
+	}
+	for fname, data := range files {
+		if err := ioutil.WriteFile(filepath.Join(tdir, fname), data, 0644); err != nil {
+			test.Error("setup failed:", err)
+		}
+	}
+
+	a, err := NewAsset(filepath.Join(tdir, "image"), "/p/image")
+	if err != nil {
+		test.Fatal(err)
+	}
+	if a.Type != "image/png" || a.MediaType() != "image" || a.Width != 5 || a.Height != 5 ||
+		a.Size != int64(len(asset)) || len(a.Hash) != 64 || a.String() != "/p/image" {
+		test.Errorf("invalid image Asset: %+v", a)
+	}
+
+	if a, err = NewAsset(filepath.Join(tdir, "audio.wav"), "/p/audio.wav"); err != nil {
+		test.Fatal(err)
+	} else if a.MediaType() != "audio" || a.Duration != 2*time.Second {
+		test.Errorf("invalid audio Asset: %+v", a)
+	}
+
+	if a, err = NewAsset(filepath.Join(tdir, "doc.txt"), "/p/doc.txt"); err != nil {
+		test.Fatal(err)
+	} else if a.MediaType() != "text" || a.Size != 4 {
+		test.Errorf("invalid text Asset: %+v", a)
+	}
+
+	if err = os.RemoveAll(tdir); err != nil {
+		test.Error(err)
+	}
+}
+
+func TestReadMp4Info(test *testing.T) {
+	test.Parallel()
+
+	box := func(name string, data ...[]byte) []byte {
+		body := bytes.Join(data, nil)
+		hdr := make([]byte, 8)
+		binary.BigEndian.PutUint32(hdr, uint32(8+len(body)))
+		copy(hdr[4:], name)
+		return append(hdr, body...)
+	}
+	u32 := func(v ...uint32) []byte {
+		buf := make([]byte, 4*len(v))
+		for i, n := range v {
+			binary.BigEndian.PutUint32(buf[i*4:], n)
+		}
+		return buf
+	}
+
+	mvhd := box("mvhd", u32(0, 0, 0, 1000, 90500), make([]byte, 80))
+	tkhd := box("tkhd", u32(0, 0, 0, 1, 0, 0), make([]byte, 52), u32(640<<16, 360<<16))
+	data := append(box("ftyp", []byte("isom")), box("moov", mvhd, box("trak", tkhd))...)
+
+	w, h, d := readMp4Info(bytes.NewReader(data))
+	if w != 640 || h != 360 || d != 90500*time.Millisecond {
+		test.Fatalf("readMp4Info returned %dx%d %s", w, h, d)
+	}
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Bundle is a set of CSS or JS asset files that are concatenated into a
+// single output file.
+type Bundle struct {
+	// Output is the URL path of the bundle file written to `Config.Output`
+	// (e.g. "/css/site.css"), it's extension sets the bundle file type.
+	Output string
+	// Files is the list of filepaths concatenated (in order) into the bundle.
+	Files []string
+}
+
+// sourceMap is the data structure written as a (version 3) source map.
+type sourceMap struct {
+	Version        int      `json:"version"`
+	File           string   `json:"file"`
+	Sources        []string `json:"sources"`
+	SourcesContent []string `json:"sourcesContent"`
+	Names          []string `json:"names"`
+	Mappings       string   `json:"mappings"`
+}
+
+const vlqChars = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789+/"
+
+// vlq returns `n` encoded as a base64 VLQ, as used by source map mappings.
+func vlq(n int) string {
+	v := n << 1
+	if n < 0 {
+		v = (-n << 1) | 1
+	}
+
+	var out []byte
+	for {
+		digit := v & 31
+		if v >>= 5; v > 0 {
+			digit |= 32
+		}
+		out = append(out, vlqChars[digit])
+		if v == 0 {
+			break
+		}
+	}
+	return string(out)
+}
+
+// mappingsBuilder builds the "mappings" value of a source map, segments
+// are added to the current line with `add` and new lines are started with `newline`.
+type mappingsBuilder struct {
+	buf                   strings.Builder
+	lineSegments          int
+	src, srcLine, lastCol int
+}
+
+func (m *mappingsBuilder) add(col, src, srcLine int) {
+	if m.lineSegments > 0 {
+		m.buf.WriteByte(',')
+	}
+	m.buf.WriteString(vlq(col - m.lastCol))
+	m.buf.WriteString(vlq(src - m.src))
+	m.buf.WriteString(vlq(srcLine - m.srcLine))
+	m.buf.WriteString(vlq(0))
+	m.lastCol, m.src, m.srcLine = col, src, srcLine
+	m.lineSegments++
+}
+
+func (m *mappingsBuilder) newline() {
+	m.buf.WriteByte(';')
+	m.lineSegments = 0
+	m.lastCol = 0
+}
+
+// Build concatenates the files of `b` and returns the result, along with a
+// source map of it. `minify` sets whether the result is minified.
+func (b Bundle) Build(minify bool) (out []byte, smap sourceMap, err error) {
+	t := minifyTypes[strings.ToLower(path.Ext(b.Output))]
+	if t != "css" && t != "js" {
+		err = fmt.Errorf("bundle %s: only css & js files can be bundled", b.Output)
+		return
+	}
+
+	smap.Version = 3
+	smap.File = path.Base(b.Output)
+	smap.Names = []string{}
+
+	var lines []sourceLine
+	for i, fpath := range b.Files {
+		var buf []byte
+		if buf, err = ioutil.ReadFile(fpath); err != nil {
+			return
+		}
+		smap.Sources = append(smap.Sources, filepath.ToSlash(fpath))
+		smap.SourcesContent = append(smap.SourcesContent, string(buf))
+
+		var src []sourceLine
+		for n, l := range strings.Split(strings.TrimSuffix(string(buf), "\n"), "\n") {
+			src = append(src, sourceLine{Text: strings.TrimSuffix(l, "\r"), Src: i, Line: n})
+		}
+		if minify {
+			src = minifyLines(src, t)
+		}
+		lines = append(lines, src...)
+	}
+
+	var mappings string
+	out, mappings = joinLines(lines, t, minify)
+	out = append(out, '\n')
+	smap.Mappings = mappings
+	return
+}
+
+// joinLines joins `lines` of the CSS or JS file type `t` and returns the
+// result, along with the source map mappings of each line. If `minify` is
+// true the lines are joined as minified lines (see `lineSeparator`),
+// otherwise they're joined by newlines. Lines that start inside a quoted
+// string are always joined by a newline, since it's part of the string.
+func joinLines(lines []sourceLine, t string, minify bool) (out []byte, mappings string) {
+	var buf bytes.Buffer
+	var m mappingsBuilder
+	col := 0
+	for i, l := range lines {
+		text := l.Text
+		if i > 0 {
+			sep := "\n"
+			if minify && !l.Quoted {
+				sep = lineSeparator(lines[i-1].Text, text, t)
+				if t == "css" && strings.HasPrefix(text, "}") && bytes.HasSuffix(buf.Bytes(), []byte(";")) {
+					buf.Truncate(buf.Len() - 1)
+					col--
+				}
+			}
+			buf.WriteString(sep)
+			if sep == "\n" {
+				m.newline()
+				col = 0
+			} else {
+				col += len(sep)
+			}
+		}
+		m.add(col, l.Src, l.Line)
+		buf.WriteString(text)
+		col += len(text)
+	}
+	return buf.Bytes(), m.buf.String()
+}
+
+// sourceMapComment returns the comment linking a bundle of type `t` to
+// it's source map at `url`.
+func sourceMapComment(url, t string) string {
+	if t == "css" {
+		return fmt.Sprintf("/*# sourceMappingURL=%s */\n", url)
+	}
+	return fmt.Sprintf("//# sourceMappingURL=%s\n", url)
+}
+
+// WriteBundle builds `b` and writes it to `outDir`, returning the URL path
+// of the written bundle. If `fingerprint` is true, the bundle filename is
+// fingerprinted and added to `manifest`. If `sourceMaps` is true, a source
+// map is written alongside the bundle (with a ".map" extension appended).
+func WriteBundle(b Bundle, outDir string, minify, fingerprint, sourceMaps bool) (url string, err error) {
+	var out []byte
+	var smap sourceMap
+	if out, smap, err = b.Build(minify); err != nil {
+		return
+	}
+
+	url = "/" + strings.TrimPrefix(b.Output, "/")
+	if fingerprint {
+		sum := sha256.Sum256(out)
+		url = manifest.Add(url, hex.EncodeToString(sum[:]))
+	}
+	dst := filepath.Join(outDir, filepath.FromSlash(url))
+	if err = os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return
+	}
+
+	if sourceMaps {
+		smap.File = path.Base(url)
+		for i, src := range smap.Sources {
+			if rel, e := filepath.Rel(filepath.Dir(dst), src); e == nil {
+				smap.Sources[i] = filepath.ToSlash(rel)
+			}
+		}
+
+		var buf []byte
+		if buf, err = json.Marshal(smap); err != nil {
+			return
+		}
+		if err = replaceFile(dst+".map", buf, 0644); err != nil {
+			return
+		}
+		out = append(out, sourceMapComment(path.Base(url)+".map", minifyTypes[path.Ext(url)])...)
+	}
+
+	err = replaceFile(dst, out, 0644)
+	return
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestVlq(test *testing.T) {
+	test.Parallel()
+
+	for n, expect := range map[int]string{0: "A", 1: "C", -1: "D", 15: "e", 16: "gB", 1000: "w+B"} {
+		if v := vlq(n); v != expect {
+			test.Errorf("vlq(%d) returned '%s' (should be '%s')", n, v, expect)
+		}
+	}
+}
+
+func TestWriteBundle(test *testing.T) {
+	test.Parallel()
+
+	tdir := filepath.Join(os.TempDir(), "pagr_test", "TestWriteBundle")
+	if err := os.MkdirAll(tdir, 0775); err != nil {
+		test.Errorf("failed to create temporary test dir: %s", tdir)
+	}
+
+	files := map[string]string{
+		"a.js": "// a\nvar a = 1;\n",
+		"b.js": "var b = 2;\n\nvar c = 3;\n",
+	}
+	var bundle Bundle
+	bundle.Output = "/js/site.js"
+	for _, fname := range []string{"a.js", "b.js"} {
+		fpath := filepath.Join(tdir, fname)
+		if err := ioutil.WriteFile(fpath, []byte(files[fname]), 0644); err != nil {
+			test.Error("setup failed:", err)
+		}
+		bundle.Files = append(bundle.Files, fpath)
+	}
+
+	outDir := filepath.Join(tdir, "out")
+	url, err := WriteBundle(bundle, outDir, true, false, true)
+	if err != nil {
+		test.Fatal(err)
+	} else if url != "/js/site.js" {
+		test.Fatalf("WriteBundle returned '%s'", url)
+	}
+
+	buf, err := ioutil.ReadFile(filepath.Join(outDir, "js", "site.js"))
+	if err != nil {
+		test.Fatal(err)
+	}
+	if expect := "var a = 1;\nvar b = 2;\nvar c = 3;\n//# sourceMappingURL=site.js.map\n"; string(buf) != expect {
+		test.Fatalf("invalid bundle written:\n%s\nshould be:\n%s", buf, expect)
+	}
+
+	var smap sourceMap
+	if buf, err = ioutil.ReadFile(filepath.Join(outDir, "js", "site.js.map")); err != nil {
+		test.Fatal(err)
+	} else if err = json.Unmarshal(buf, &smap); err != nil {
+		test.Fatal(err)
+	}
+	// a.js:1, b.js:0, b.js:2
+	if smap.Mappings != "AACA;ACDA;AAEA" || len(smap.Sources) != 2 || !strings.HasSuffix(smap.Sources[1], "b.js") {
+		test.Fatalf("invalid source map: %+v", smap)
+	}
+
+	// an empty line inside a string (see `joinLines`)
+	css := filepath.Join(tdir, "a.css")
+	if err = ioutil.WriteFile(css, []byte("a {\n\tcontent: \"x\\\n\n\";\n}\nb { color: red; }\n"), 0644); err != nil {
+		test.Error("setup failed:", err)
+	}
+	if out, _, err := (Bundle{Output: "/site.css", Files: []string{css}}).Build(true); err != nil {
+		test.Error(err)
+	} else if expect := "a{content:\"x\\\n\n\"}b{color:red}\n"; string(out) != expect {
+		test.Errorf("invalid minified css bundle:\n%s\nshould be:\n%s", out, expect)
+	}
+
+	if _, err = WriteBundle(Bundle{Output: "/x.txt"}, outDir, false, false, false); err == nil {
+		test.Error("no error returned for invalid bundle type")
+	}
+
+	if err = os.RemoveAll(tdir); err != nil {
+		test.Error(err)
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// OutputSet is the set of filepaths written to the output directory in a build.
+type OutputSet map[string]bool
+
+// written is the OutputSet of all files written in the current build.
+var written = make(OutputSet)
+
+// Add adds the filepath `fpath` to `s`.
+func (s OutputSet) Add(fpath string) {
+	s[filepath.Clean(fpath)] = true
+}
+
+// AddURL adds the file at the URL path `url` in the directory `root` to `s`.
+func (s OutputSet) AddURL(root, url string) {
+	s.Add(filepath.Join(root, filepath.FromSlash(url)))
+}
+
+// keepFile returns true if the path `rel` (relative to the output
+// directory) matches one of the `keep` glob patterns. Patterns are matched
+// against both the full relative path and it's base name (so ".git" keeps
+// any ".git" directory).
+func keepFile(rel string, keep []string) bool {
+	rel = filepath.ToSlash(rel)
+	for _, pattern := range keep {
+		pattern = strings.Trim(filepath.ToSlash(pattern), "/")
+		if ok, _ := path.Match(pattern, rel); ok {
+			return true
+		} else if ok, _ = path.Match(pattern, path.Base(rel)); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Stale returns all the files found in `root` that are not in `s` and do not
+// match any of the `keep` glob patterns (see `keepFile`), sorted by path.
+func (s OutputSet) Stale(root string, keep []string) (stale []string, err error) {
+	err = filepath.Walk(root, func(fpath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(root, fpath)
+		if rel == "." {
+			return nil
+		} else if keepFile(rel, keep) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !info.IsDir() && !s[filepath.Clean(fpath)] {
+			stale = append(stale, fpath)
+		}
+		return nil
+	})
+	sort.Strings(stale)
+	return
+}
+
+// RemoveStale removes the `stale` files found in `root` and any
+// directories in `root` left empty by their removal.
+func RemoveStale(root string, stale []string) (err error) {
+	root = filepath.Clean(root)
+	dirs := make(map[string]bool)
+	for _, fpath := range stale {
+		if err = os.Remove(fpath); err != nil {
+			return
+		}
+		for dir := filepath.Dir(fpath); dir != root && strings.HasPrefix(dir, root); dir = filepath.Dir(dir) {
+			dirs[dir] = true
+		}
+	}
+
+	var sorted []string
+	for dir := range dirs {
+		sorted = append(sorted, dir)
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(sorted))) // children first
+	for _, dir := range sorted {
+		if f, e := os.Open(dir); e == nil {
+			_, e = f.Readdirnames(1)
+			f.Close()
+			if e != nil { // empty
+				if err = os.Remove(dir); err != nil {
+					return
+				}
+			}
+		}
+	}
+	return
+}
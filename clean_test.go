@@ -0,0 +1,72 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestOutputSetStale(test *testing.T) {
+	test.Parallel()
+
+	tdir := filepath.Join(os.TempDir(), "pagr_test", "TestOutputSetStale")
+	files := []string{
+		"index.html",
+		"old/index.html",
+		"old/deeper/index.html",
+		"css/style.css",
+		"css/old.css",
+		"CNAME",
+		".git/HEAD",
+	}
+	for _, f := range files {
+		fpath := filepath.Join(tdir, f)
+		if err := os.MkdirAll(filepath.Dir(fpath), 0775); err != nil {
+			test.Fatal("setup failed:", err)
+		}
+		if err := ioutil.WriteFile(fpath, []byte(f), 0644); err != nil {
+			test.Fatal("setup failed:", err)
+		}
+	}
+
+	set := make(OutputSet)
+	set.Add(filepath.Join(tdir, "index.html"))
+	set.AddURL(tdir, "/css/style.css")
+
+	stale, err := set.Stale(tdir, []string{".git", "CNAME"})
+	if err != nil {
+		test.Fatal(err)
+	}
+	expect := []string{
+		filepath.Join(tdir, "css/old.css"),
+		filepath.Join(tdir, "old/deeper/index.html"),
+		filepath.Join(tdir, "old/index.html"),
+	}
+	if len(stale) != len(expect) {
+		test.Fatalf("Stale returned %v (should be %v)", stale, expect)
+	}
+	for i := range expect {
+		if stale[i] != expect[i] {
+			test.Errorf("Stale returned %s (should be %s)", stale[i], expect[i])
+		}
+	}
+
+	if err = RemoveStale(tdir, stale); err != nil {
+		test.Fatal(err)
+	}
+	for _, f := range []string{"index.html", "css/style.css", "CNAME", ".git/HEAD"} {
+		if _, err = os.Stat(filepath.Join(tdir, f)); err != nil {
+			test.Errorf("RemoveStale removed %s", f)
+		}
+	}
+	for _, f := range []string{"css/old.css", "old"} {
+		if _, err = os.Stat(filepath.Join(tdir, f)); err == nil {
+			test.Errorf("RemoveStale did not remove %s", f)
+		}
+	}
+
+	if err = os.RemoveAll(tdir); err != nil {
+		test.Error(err)
+	}
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Command is a pagr subcommand, run with `pagr [flags] NAME [flags] ARGS`.
+type Command struct {
+	Name     string
+	Args     string // usage of the command arguments, e.g. "[ADDR]"
+	Desc     string
+	Flags    func(fs *flag.FlagSet) // registers the flags of the command
+	Run      func(args []string)
+	NoConfig bool // if true, the project config isn't loaded
+
+	fs *flag.FlagSet
+}
+
+// commands are all the pagr subcommands, "build" is run if no command is
+// given.
+var commands []*Command
+
+var flagVersion bool
+var flagOutput string
+var flagContents string
+var flagOverrides stringsFlag
+
+// stringsFlag is a flag.Value that's appended to each time it's set.
+type stringsFlag []string
+
+func (s *stringsFlag) String() string {
+	return strings.Join(*s, ", ")
+}
+
+func (s *stringsFlag) Set(value string) error {
+	*s = append(*s, value)
+	return nil
+}
+
+func init() {
+	commands = []*Command{
+		{
+			Name:  "build",
+			Desc:  "build the project (the default command).",
+			Flags: buildFlags,
+			Run:   runBuild,
+		}, {
+			Name: "serve",
+			Args: "[ADDR]",
+			Desc: "build the project in development mode and serve it at ADDR (default \"localhost:8080\"),\nrebuilding it whenever a file changes.",
+			Run:  runServe,
+		}, {
+			Name: "new",
+			Args: "site DIR | page PATH",
+			Desc: "create a new project in DIR, or a new page in the project at PATH (from an archetype).",
+			Flags: func(fs *flag.FlagSet) {
+				fs.StringVar(&flagFormat, "format", "yaml", "data format of the config & meta files created (json, yaml or toml)")
+			},
+			Run: newProject,
+		}, {
+			Name:  "check",
+			Desc:  "build the project and check the links in all built html files, exits non-zero if any are broken.",
+			Flags: buildFlags,
+			Run:   runCheck,
+		}, {
+			Name: "clean",
+			Desc: "remove all files in the output directory, except those matching Config.Keep.",
+			Flags: func(fs *flag.FlagSet) {
+				fs.BoolVar(&flagDryRun, "dry-run", false, "list the files that would be removed, without removing them")
+			},
+			Run: runClean,
+		}, {
+			Name: "list",
+			Desc: "list the pages of the project, with the output files & templates they're built with.",
+			Run:  list,
+		}, {
+			Name: "deploy",
+			Args: "[TARGET...]",
+			Desc: "deploy the output directory to the named targets in Config.Deploy (or all of them).",
+			Flags: func(fs *flag.FlagSet) {
+				fs.BoolVar(&flagDryRun, "dry-run", false, "list the files that would be uploaded & deleted, without changing them")
+			},
+			Run: deploy,
+		}, {
+			Name:     "version",
+			Desc:     "print the pagr version.",
+			Run:      func([]string) { printVersion() },
+			NoConfig: true,
+		},
+	}
+
+	flag.Usage = usage
+	commonFlags(flag.CommandLine)
+	flag.BoolVar(&flagVersion, "version", false, "print the pagr version and exit")
+	// flags of the default command
+	buildFlags(flag.CommandLine)
+
+	for _, cmd := range commands {
+		cmd.fs = flag.NewFlagSet(Name+" "+cmd.Name, flag.ExitOnError)
+		commonFlags(cmd.fs)
+		if cmd.Flags != nil {
+			cmd.Flags(cmd.fs)
+		}
+		cmd.fs.Usage = cmd.usage
+	}
+}
+
+// commonFlags registers the flags available to every command in `fs`.
+func commonFlags(fs *flag.FlagSet) {
+	fs.BoolVar(&flagVerbose, "v", false, "print verbose ilog.")
+	fs.StringVar(&flagConfig, "cfg", "", "path to pagr project configuration file")
+	fs.Var(&flagOverrides, "set", "override a config value with KEY=VALUE, e.g. \"BasePath=/blog/\" or \"Search.Output=index.json\"\n(lists are comma-separated, can be used multiple times). Unlike paths in the config file,\nrelative paths are relative to the working directory")
+	fs.StringVar(&flagOutput, "o", "", "override the output directory (Config.Output), relative to the working directory")
+	fs.StringVar(&flagContents, "contents", "", "override the content directory (Config.Contents), relative to the working directory")
+}
+
+// buildFlags registers the flags of the "build" & "check" commands in `fs`.
+func buildFlags(fs *flag.FlagSet) {
+	fs.BoolVar(&flagCheck, "check", false, "check the links in all built html files, exits non-zero if any are broken")
+	fs.BoolVar(&flagClean, "clean", false, "remove any files in the output directory that were not written by the build (see Config.Keep)")
+	fs.BoolVar(&flagDryRun, "dry-run", false, "list the files that -clean would remove, without removing them")
+	fs.StringVar(&flagReport, "report", "", "print a build report in the given format (only \"json\") to stdout, exits 1 on errors or 2 on warnings")
+	fs.BoolVar(&flagStrict, "strict", false, "fail the build on missing templates, invalid meta/defaults files, unsupported content files and template errors")
+}
+
+func usage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintf(out, "usage: %s [flags] [COMMAND] [command flags] [ARGS]\n\ncommands:\n", Name)
+	for _, cmd := range commands {
+		fmt.Fprintf(out, "  %-8s %s\n", cmd.Name, strings.SplitN(cmd.Desc, "\n", 2)[0])
+	}
+	fmt.Fprintln(out, "\nflags:")
+	flag.PrintDefaults()
+	fmt.Fprintf(out, "\nrun \"%s COMMAND -h\" for the usage of COMMAND.\n", Name)
+}
+
+func (cmd *Command) usage() {
+	out := cmd.fs.Output()
+	fmt.Fprintf(out, "usage: %s %s [flags] %s\n\n%s\n\nflags:\n", Name, cmd.Name, cmd.Args, cmd.Desc)
+	cmd.fs.PrintDefaults()
+}
+
+// findCommand returns the command in `commands` called `name`, or nil.
+func findCommand(name string) *Command {
+	for _, cmd := range commands {
+		if cmd.Name == name {
+			return cmd
+		}
+	}
+	return nil
+}
+
+// parseCommand parses the global flags in `args`, followed by the command
+// (defaulting to "build") and it's flags. The command and it's arguments
+// are returned.
+func parseCommand(args []string) (*Command, []string) {
+	flag.CommandLine.Parse(args)
+	if flagVersion {
+		printVersion()
+		os.Exit(ExitOK)
+	}
+
+	name, args := "build", flag.Args()
+	if len(args) > 0 {
+		name, args = args[0], args[1:]
+	}
+	cmd := findCommand(name)
+	if cmd == nil {
+		elog.Printf("unknown command '%s'\n\n", name)
+		flag.Usage()
+		os.Exit(ExitError)
+	}
+	cmd.fs.Parse(args)
+	return cmd, cmd.fs.Args()
+}
+
+// applyConfigFlags applies the config overrides set by the "-set", "-o" &
+// "-contents" flags to `cfg`. They're applied after `Config.relPaths`, so
+// relative paths in them are left relative to the working directory.
+func applyConfigFlags(cfg *Config) error {
+	for _, s := range flagOverrides {
+		kv := strings.SplitN(s, "=", 2)
+		if len(kv) != 2 {
+			return fmt.Errorf("invalid -set value '%s' (should be KEY=VALUE)", s)
+		}
+		if err := cfg.Set(kv[0], kv[1]); err != nil {
+			return err
+		}
+	}
+	if len(flagOutput) > 0 {
+		cfg.Output = flagOutput
+	}
+	if len(flagContents) > 0 {
+		cfg.Contents = flagContents
+	}
+	return nil
+}
+
+func printVersion() {
+	fmt.Printf("%s %s\n", Name, Version)
+}
+
+func runBuild([]string) {
+	build()
+	if len(flagReport) > 0 {
+		writeReport()
+		os.Exit(report.ExitCode())
+	}
+}
+
+func runCheck(args []string) {
+	flagCheck = true
+	runBuild(args)
+}
+
+func runServe(args []string) {
+	addr := "localhost:8080"
+	if len(args) > 0 {
+		addr = args[0]
+	}
+	serve(addr)
+}
+
+// runClean removes (or lists, with -dry-run) every file in `config.Output`
+// that isn't kept, see `cleanOutput`.
+func runClean([]string) {
+	config.Staging = false
+	cleanOutput(config.Output)
+}
@@ -1,9 +1,14 @@
 package main
 
 import (
+	"encoding/json"
+	"fmt"
 	"notabug.org/gearsix/suti"
 	"os"
 	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
 )
 
 // Config is the data structure containing all key/values to be loaded
@@ -13,12 +18,150 @@ type Config struct {
 	Templates       string
 	Assets          []string
 	Output          string
+	BasePath        string
 	DefaultTemplate string
+	Generators      []Generator
+	// BaseURL is the scheme & host the site is served from (e.g.
+	// "https://example.com"), used by the "absURL" template function.
+	BaseURL string
+	// OutputFiles maps output format names to the filename pages are
+	// written to for that format, see `Config.OutputFile`.
+	OutputFiles map[string]string
+	Search      SearchConfig
+	Images      ImageConfig
+	// Fingerprint sets whether asset filenames have a hash of their content
+	// inserted before the extension (e.g. "style.3f2a9c.css"). The mapping of
+	// logical to fingerprinted paths is written to `Manifest` in `Output`.
+	Fingerprint bool
+	Manifest    string
+	Bundles     []Bundle
+	// Minify is a list of file types ("css", "js", "html", "svg", "json")
+	// that are minified when they're written to `Output`.
+	Minify []string
+	// SourceMaps sets whether a source map is written for each bundle.
+	SourceMaps bool
+	// Preprocessors are the transformations applied to asset files (by
+	// extension) when they're copied to `Output`.
+	Preprocessors []Preprocessor
+	// CopyMode sets how unchanged files are copied to `Output`, either
+	// "copy" (default), "hardlink" or "reflink", see `CopyFile`.
+	CopyMode string
+	// Staging sets whether the build is written to a staging directory
+	// (a copy of `Output`), which only replaces `Output` if the build
+	// succeeds. The previous build is kept in a backup directory
+	// ("`Output`.bak"), see `BeginStaging`. It's set by default, set it to
+	// false to build directly into `Output` (e.g. "-set Staging=false").
+	Staging bool
+	// Keep is a list of glob patterns for files in `Output` that are never
+	// removed by the -clean flag (matched against the path relative to
+	// `Output` and the file name), e.g. ".git" or "CNAME".
+	Keep []string
+	// Strict sets whether missing templates, invalid meta/defaults files,
+	// unsupported content files and template errors fail the build, rather
+	// than being skipped with a warning (see the -strict flag).
+	Strict bool
+	// Drafts sets whether pages with "Draft" set to true in their Meta are
+	// built, if false they're skipped.
+	Drafts bool
+	// Deploy is the list of targets that `Output` can be deployed to with
+	// the "deploy" command.
+	Deploy []DeployTarget
+	// CheckExternal sets whether links to other hosts are requested when
+	// checking links, if false they're skipped.
+	CheckExternal bool
+	// Theme is the name of the theme used by the site, a directory in
+	// `ThemesDir` (see `Theme`). Themes is a list of further themes that
+	// `Theme` is stacked on top of, each overriding the themes listed after
+	// it (so `Theme` overrides all of them).
+	Theme     string
+	Themes    []string
+	ThemesDir string
+	// I18n is the directory that translations are loaded from, see
+	// `LoadI18nDir`. Language is the default language they're used in.
+	I18n     string
+	Language string
+	// Archetypes is the directory of archetypes that new pages are created
+	// from by "new page", see `NewContentPage`.
+	Archetypes string
+
+	dir string // the project directory, relative paths are set from it
+}
+
+// ThemeNames returns the names of the themes used by `cfg`, in the order
+// they override each other (the first overrides the rest).
+func (cfg *Config) ThemeNames() (names []string) {
+	if len(cfg.Theme) > 0 {
+		names = append(names, cfg.Theme)
+	}
+	return append(names, cfg.Themes...)
+}
+
+// OutputFile returns the filename that pages with the output `format`
+// should be written to. If `cfg.OutputFiles` doesn't have a filename set
+// for `format`, then "index.`format`" is returned.
+func (cfg *Config) OutputFile(format string) string {
+	if fname, ok := cfg.OutputFiles[format]; ok && len(fname) > 0 {
+		return fname
+	}
+	return "index." + format
+}
+
+// Set sets the value of the field `key` in `cfg` to `value`. `key` is the
+// name of a field (case-insensitive), fields of nested structs are set with
+// dotted keys (e.g. "Search.Output"). List values are comma-separated.
+func (cfg *Config) Set(key, value string) (err error) {
+	v := reflect.ValueOf(cfg).Elem()
+	for _, name := range strings.Split(key, ".") {
+		if v.Kind() != reflect.Struct {
+			return fmt.Errorf("invalid config key '%s'", key)
+		}
+		field, ok := v.Type().FieldByNameFunc(func(field string) bool { return strings.EqualFold(field, name) })
+		if !ok || len(field.PkgPath) > 0 { // unexported
+			return fmt.Errorf("unknown config key '%s'", key)
+		}
+		v = v.FieldByIndex(field.Index)
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(value)
+	case reflect.Bool:
+		var b bool
+		if b, err = strconv.ParseBool(value); err == nil {
+			v.SetBool(b)
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		var i int64
+		if i, err = strconv.ParseInt(value, 10, 64); err == nil {
+			v.SetInt(i)
+		}
+	case reflect.Float32, reflect.Float64:
+		var f float64
+		if f, err = strconv.ParseFloat(value, 64); err == nil {
+			v.SetFloat(f)
+		}
+	case reflect.Slice:
+		if v.Type().Elem().Kind() != reflect.String {
+			return fmt.Errorf("config key '%s' can't be set from a string", key)
+		}
+		var list []string
+		if len(value) > 0 {
+			list = strings.Split(value, ",")
+		}
+		v.Set(reflect.ValueOf(list).Convert(v.Type()))
+	default:
+		return fmt.Errorf("config key '%s' can't be set from a string", key)
+	}
+	if err != nil {
+		err = fmt.Errorf("invalid value for config key '%s': %s", key, err)
+	}
+	return
 }
 
 // relPaths sets all filepath values in `cfg` relative to `dir`
 func (cfg *Config) relPaths(dir string) {
-	var paths = []string{cfg.Contents, cfg.Templates, cfg.Output}
+	cfg.dir = dir
+	var paths = []string{cfg.Contents, cfg.Templates, cfg.Output, cfg.ThemesDir, cfg.I18n, cfg.Archetypes}
 	paths = append(paths, cfg.Assets...)
 	for i, path := range paths {
 		if !filepath.IsAbs(path) {
@@ -28,7 +171,22 @@ func (cfg *Config) relPaths(dir string) {
 	cfg.Contents = paths[0]
 	cfg.Templates = paths[1]
 	cfg.Output = paths[2]
-	cfg.Assets = paths[3:]
+	cfg.ThemesDir = paths[3]
+	cfg.I18n = paths[4]
+	cfg.Archetypes = paths[5]
+	cfg.Assets = paths[6:]
+	for i, g := range cfg.Generators {
+		if !filepath.IsAbs(g.Source) {
+			cfg.Generators[i].Source = filepath.Join(dir, g.Source)
+		}
+	}
+	for _, b := range cfg.Bundles {
+		for i, f := range b.Files {
+			if !filepath.IsAbs(f) {
+				b.Files[i] = filepath.Join(dir, f)
+			}
+		}
+	}
 	return
 }
 
@@ -39,13 +197,27 @@ func NewConfig() Config {
 		Templates:       "./templates",
 		Assets:          []string{"./assets"},
 		Output:          "./out",
+		ThemesDir:       "./themes",
+		I18n:            "./i18n",
+		Language:        "en",
+		Archetypes:      "./archetypes",
+		dir:             ".",
+		BasePath:        "/",
 		DefaultTemplate: "default",
+		Manifest:        "manifest.json",
+		Keep:            []string{".git", "CNAME"},
+		CopyMode:        CopyModeCopy,
+		Staging:         true,
+		Search: SearchConfig{
+			SummaryLength: 160,
+		},
 	}
 }
 
 // NewConfigFromFile returns a Config with values read from the config file found at `fpath`.
 // If values from the file are missing, default values are used.
-// suti.LoadDataFile() is called to load the file (see notabug.org/gearsix/suti).
+// suti.LoadDataFile() is called to load the file (see notabug.org/gearsix/suti),
+// keys are matched to Config fields case-insensitively in every data format.
 // Any relative filepaths in the returned Config are set relative to the parent directory of `fpath`.
 func NewConfigFromFile(fpath string) (cfg Config, err error) {
 	cfg = NewConfig()
@@ -54,9 +226,19 @@ func NewConfigFromFile(fpath string) (cfg Config, err error) {
 		return
 	}
 
-	if err = suti.LoadDataFilepath(fpath, &cfg); err != nil {
+	// the yaml decoder only matches lowercase keys to fields, so the values
+	// are decoded with encoding/json (which ignores case) instead
+	var data map[string]interface{}
+	if err = suti.LoadDataFilepath(fpath, &data); err != nil {
 		return
 	}
+	var buf []byte
+	if buf, err = json.Marshal(data); err == nil {
+		err = json.Unmarshal(buf, &cfg)
+	}
+	if err != nil {
+		return cfg, fmt.Errorf("%s: %s", fpath, err)
+	}
 
 	cfg.relPaths(filepath.Dir(fpath))
 	return
@@ -50,3 +50,36 @@ func TestNewConfigFromFile(test *testing.T) {
 		test.Error(err)
 	}
 }
+
+func TestConfigSet(test *testing.T) {
+	test.Parallel()
+
+	cfg := NewConfig()
+	for key, value := range map[string]string{
+		"output":               "./public",
+		"BasePath":             "/blog/",
+		"Fingerprint":          "true",
+		"Assets":               "a,b",
+		"search.summaryLength": "80",
+	} {
+		if err := cfg.Set(key, value); err != nil {
+			test.Errorf("Set(%s, %s) failed: %s", key, value, err)
+		}
+	}
+	if cfg.Output != "./public" || cfg.BasePath != "/blog/" || !cfg.Fingerprint ||
+		len(cfg.Assets) != 2 || cfg.Assets[1] != "b" || cfg.Search.SummaryLength != 80 {
+		test.Errorf("invalid config after Set: %+v", cfg)
+	}
+
+	for key, value := range map[string]string{
+		"missing":              "x",
+		"Output.x":             "x",
+		"Strict":               "maybe",
+		"Search.SummaryLength": "many",
+		"Deploy":               "x",
+	} {
+		if err := cfg.Set(key, value); err == nil {
+			test.Errorf("Set(%s, %s) didn't fail", key, value)
+		}
+	}
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"bufio"
 	"bytes"
+	"encoding/json"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -17,7 +18,9 @@ import (
 	"github.com/yuin/goldmark"
 	goldmarkext "github.com/yuin/goldmark/extension"
 	goldmarkparse "github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
 	goldmarkhtml "github.com/yuin/goldmark/renderer/html"
+	"github.com/yuin/goldmark/util"
 	"notabug.org/gearsix/suti"
 )
 
@@ -40,6 +43,49 @@ func isContentExt(ext string) int {
 	return -1
 }
 
+// unsupportedContentExts are the file extensions of markup languages that
+// pagr can't convert, files with these extensions are copied as assets
+// (or fail the build, in strict mode).
+var unsupportedContentExts = []string{
+	".markdown", ".mdown", ".mkd", ".mkdn", ".rst", ".adoc", ".asciidoc", ".org", ".textile",
+}
+
+func isUnsupportedContentExt(ext string) bool {
+	ext = strings.ToLower(ext)
+	for _, unsupported := range unsupportedContentExts {
+		if ext == unsupported {
+			return true
+		}
+	}
+	return false
+}
+
+// isUnknownExt returns true if files with the extension `ext` are neither
+// content, data nor an asset with a known MIME type (see `assetTypes`).
+func isUnknownExt(ext string) bool {
+	return isContentExt(ext) == -1 && suti.IsSupportedDataLang(ext) == -1 &&
+		len(mime.TypeByExtension(ext)) == 0
+}
+
+// dataError returns `err` (returned when loading the data file at `fpath`)
+// prefixed with `fpath` and, for JSON syntax & type errors, the line number
+// the error occured on.
+func dataError(fpath string, err error) error {
+	var offset int64 = -1
+	switch e := err.(type) {
+	case *json.SyntaxError:
+		offset = e.Offset
+	case *json.UnmarshalTypeError:
+		offset = e.Offset
+	}
+	if offset >= 0 {
+		if buf, e := ioutil.ReadFile(fpath); e == nil && offset <= int64(len(buf)) {
+			return fmt.Errorf("%s:%d: %s", fpath, bytes.Count(buf[:offset], []byte("\n"))+1, err)
+		}
+	}
+	return fmt.Errorf("%s: %s", fpath, err)
+}
+
 // FIX kills performance on windows
 func gitModTime(fpath string) (mod time.Time, err error) {
 	if gitBin == "" {
@@ -98,8 +144,9 @@ func lastPageMod(fpath string) (t time.Time) {
 // For each directory, a new `Page` element will be generated, any file with a
 // filetype found in `contentExts`, will be parsed into a string of HTML
 // and appended to the `.Content` of the `Page` generated for it's parent
-// directory.
-func LoadContentDir(dir string) (p []Page, e error) {
+// directory. The default Meta of `themes` is applied to each page (see
+// `ApplyThemeMeta`) before drafts are skipped and it's content is converted.
+func LoadContentDir(dir string, themes ...Theme) (p []Page, e error) {
 	if _, e = os.Stat(dir); e != nil {
 		return
 	}
@@ -107,6 +154,7 @@ func LoadContentDir(dir string) (p []Page, e error) {
 
 	pages := make(map[string]Page)
 	dmeta := make(map[string]Meta)
+	links := &LinkResolver{Root: dir, Base: config.BasePath}
 
 	e = filepath.Walk(dir, func(fpath string, info os.FileInfo, err error) error {
 		if err != nil || ignoreFile(fpath) {
@@ -118,13 +166,21 @@ func LoadContentDir(dir string) (p []Page, e error) {
 			pages[path] = NewPage(path, lastPageMod(fpath))
 		} else {
 			path := pagePath(dir, filepath.Dir(fpath))
-			pages[path], dmeta, err = loadContentFile(pages[path], dmeta, fpath, path)
+			pages[path], dmeta, err = loadContentFile(pages[path], dmeta, fpath, path, links)
 		}
 		return err
 	})
+	if e != nil {
+		return
+	}
 
 	for _, page := range pages {
 		page.applyDefaults(dmeta)
+		page.applyThemeMeta(themes)
+		if page.skipDraft() {
+			continue
+		}
+		page.Assets.classify()
 		p = append(p, page)
 	}
 
@@ -139,17 +195,34 @@ func LoadContentDir(dir string) (p []Page, e error) {
 
 	p = BuildSitemap(p)
 
+	// content is converted once all pages are loaded, so shortcodes have
+	// access to the complete page
+	for i := range p {
+		for _, fpath := range p[i].contentFiles {
+			if e = p[i].convertContentFile(fpath, links); e != nil {
+				return
+			}
+		}
+		p[i].contentFiles = nil
+	}
+
 	return
 }
 
-func loadContentFile(p Page, def map[string]Meta, fpath string, ppath string) (Page, map[string]Meta, error) {
+func loadContentFile(p Page, def map[string]Meta, fpath string, ppath string, links *LinkResolver) (Page, map[string]Meta, error) {
 	var err error
 	fname := strings.TrimSuffix(filepath.Base(fpath), filepath.Ext(fpath))
 
 	if suti.IsSupportedDataLang(filepath.Ext(fpath)) != -1 &&
 		(fname == "defaults" || fname == "meta") {
 		var m Meta
-		if err = suti.LoadDataFilepath(fpath, &m); err == nil {
+		if err = suti.LoadDataFilepath(fpath, &m); err != nil {
+			err = dataError(fpath, err)
+			if !config.Strict {
+				warn("skipping %s", err)
+				err = nil
+			}
+		} else {
 			if fname == "defaults" || fname == "default" {
 				if meta, ok := def[ppath]; ok {
 					m.MergeMeta(meta, false)
@@ -157,23 +230,29 @@ func loadContentFile(p Page, def map[string]Meta, fpath string, ppath string) (P
 				def[ppath] = m
 			} else if fname == "meta" {
 				p.Meta.MergeMeta(m, true)
+				p.sources = append(p.sources, fpath)
 			}
 		}
+	} else if (fname == "defaults" || fname == "meta") && isContentExt(filepath.Ext(fpath)) == -1 {
+		err = fmt.Errorf("%s: unsupported data file extension '%s'", fpath, filepath.Ext(fpath))
+		if !config.Strict {
+			warn("%s", err)
+			err = nil
+		}
 	} else if isContentExt(filepath.Ext(fpath)) != -1 {
-		err = p.NewContentFromFile(fpath)
+		p.contentFiles = append(p.contentFiles, fpath)
+		p.sources = append(p.sources, fpath)
+	} else if ext := filepath.Ext(fpath); isUnsupportedContentExt(ext) && config.Strict {
+		err = fmt.Errorf("%s: unsupported content file extension '%s'", fpath, ext)
+	} else if isUnknownExt(ext) && config.Strict {
+		err = fmt.Errorf("%s: unknown file extension '%s'", fpath, ext)
 	} else {
-		a := filepath.Join(ppath, filepath.Base(fpath))
-		p.Assets.All = append(p.Assets.All, a)
-		ref := &p.Assets.All[len(p.Assets.All)-1]
-		mimetype := mime.TypeByExtension(filepath.Ext(fpath))
-		if strings.Contains(mimetype, "image") {
-			p.Assets.Image = append(p.Assets.Image, ref)
-		} else if strings.Contains(mimetype, "video") {
-			p.Assets.Video = append(p.Assets.Video, ref)
-		} else if strings.Contains(mimetype, "audio") {
-			p.Assets.Audio = append(p.Assets.Audio, ref)
-		} else {
-			p.Assets.Misc = append(p.Assets.Misc, ref)
+		if isUnsupportedContentExt(ext) {
+			warn("%s: unsupported content file extension '%s', copying as an asset", fpath, ext)
+		}
+		var a Asset
+		if a, err = NewAsset(fpath, filepath.Join(ppath, filepath.Base(fpath))); err == nil {
+			p.Assets.All = append(p.Assets.All, a)
 		}
 	}
 	return p, def, err
@@ -185,7 +264,14 @@ func loadContentFile(p Page, def map[string]Meta, fpath string, ppath string) (P
 // - ".md", ".gfm", ".cm" = various flavours of markdown
 // - ".html" = parsed as-is
 // Successful conversions are appended to `p.Contents`
-func NewContentFromFile(fpath string) (c Content, err error) {
+// If `links` is not nil, relative links in markdown files are resolved with it.
+func NewContentFromFile(fpath string, links *LinkResolver) (c Content, err error) {
+	return newContentFromFile(fpath, links, nil)
+}
+
+// newContentFromFile is `NewContentFromFile`, if `p` is not nil any
+// shortcodes in markdown & HTML files are rendered with `p` (see `shortcodes`).
+func newContentFromFile(fpath string, links *LinkResolver, p *Page) (c Content, err error) {
 	var buf []byte
 	if f, err := os.Open(fpath); err == nil {
 		buf, err = ioutil.ReadAll(f)
@@ -204,9 +290,32 @@ func NewContentFromFile(fpath string) (c Content, err error) {
 			case ".txt":
 				body = convertTextToHTML(bytes.NewReader(buf))
 			case ".md":
-				body, err = convertMarkdownToHTML(buf)
+				var opts []goldmark.Option
+				if links != nil {
+					t := linkTransformer{resolver: links, fpath: fpath}
+					opts = append(opts, goldmark.WithParserOptions(
+						goldmarkparse.WithASTTransformers(util.Prioritized(t, 100))))
+				}
+				if p != nil && len(renderHooks) > 0 {
+					opts = append(opts, goldmark.WithRendererOptions(
+						renderer.WithNodeRenderers(util.Prioritized(newHookRenderer(renderHooks, p), 100))))
+				}
+				src, restore := string(buf), func(html string) string { return html }
+				if p != nil && len(shortcodes) > 0 {
+					if src, restore, err = shortcodes.renderMarkdownShortcodes(src, p, fpath); err != nil {
+						return
+					}
+				}
+				if body, err = convertMarkdownToHTML([]byte(src), opts...); err == nil {
+					body = restore(body)
+				}
 			case ".html":
 				body = string(buf)
+				if p != nil && len(shortcodes) > 0 {
+					if body, err = shortcodes.Render(body, p, fpath); err != nil {
+						return
+					}
+				}
 			default:
 				break
 			}
@@ -268,12 +377,13 @@ func convertTextToHTML(in io.Reader) (html string) {
 // convertMarkdownToHTML initialises a `goldmark.Markdown` based on `lang` and
 // returns values from calling it's `Convert` function on `in`.
 // ".md" (and anything else) = commonmark + extensions (linkify, auto-heading id, unsafe HTML)
-func convertMarkdownToHTML(buf []byte) (md string, err error) {
-	markdown := goldmark.New(
+// Any `opts` are applied to the `goldmark.Markdown` after the defaults.
+func convertMarkdownToHTML(buf []byte, opts ...goldmark.Option) (md string, err error) {
+	markdown := goldmark.New(append([]goldmark.Option{
 		goldmark.WithExtensions(goldmarkext.Linkify),
 		goldmark.WithParserOptions(goldmarkparse.WithAutoHeadingID()),
 		goldmark.WithRendererOptions(goldmarkhtml.WithUnsafe()),
-	)
+	}, opts...)...)
 	var out bytes.Buffer
 	err = markdown.Convert(buf, &out)
 	return out.String(), err
@@ -1,9 +1,11 @@
 package main
 
 import (
+	"encoding/json"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -57,7 +59,7 @@ func TestNewContentFromFile(test *testing.T) {
 
 	var p Page
 	for ftype := range contents {
-		if err = p.NewContentFromFile(contentsPath(ftype)); err != nil {
+		if err = p.NewContentFromFile(contentsPath(ftype), nil); err != nil {
 			test.Fatal("NewContentFromFile failed for", ftype, err)
 		}
 	}
@@ -66,3 +68,123 @@ func TestNewContentFromFile(test *testing.T) {
 		test.Error(err)
 	}
 }
+
+func TestDataError(test *testing.T) {
+	test.Parallel()
+
+	tdir := filepath.Join(os.TempDir(), "pagr_test", "TestDataError")
+	if err := os.MkdirAll(tdir, 0775); err != nil {
+		test.Errorf("failed to create temporary test dir: %s", tdir)
+	}
+	fpath := filepath.Join(tdir, "meta.json")
+	src := "{\n\t\"title\": \"test\",\n\t\"tags\": [,]\n}\n"
+	if err := ioutil.WriteFile(fpath, []byte(src), 0666); err != nil {
+		test.Error("setup failed:", err)
+	}
+
+	var m Meta
+	err := json.Unmarshal([]byte(src), &m)
+	if err == nil {
+		test.Fatal("setup failed: invalid json was parsed")
+	}
+	if err = dataError(fpath, err); !strings.HasPrefix(err.Error(), fpath+":3: ") {
+		test.Errorf("dataError returned '%s' (should start with '%s:3: ')", err, fpath)
+	}
+
+	if err = os.RemoveAll(tdir); err != nil {
+		test.Error(err)
+	}
+}
+
+// TestStrictContent isn't parallel, since it sets the global `config.Strict`.
+func TestStrictContent(test *testing.T) {
+	tdir := filepath.Join(os.TempDir(), "pagr_test", "TestStrictContent")
+	files := map[string]string{
+		"index.md":       "home",
+		"bad/meta.json":  "{,}",
+		"bad/index.md":   "bad",
+		"rst/page.rst":   "page",
+		"blob/data.xyz1": "?",
+		"ok/style.css":   "a{}",
+	}
+	for fname, data := range files {
+		fpath := filepath.Join(tdir, fname)
+		if err := os.MkdirAll(filepath.Dir(fpath), 0775); err != nil {
+			test.Fatal("setup failed:", err)
+		}
+		if err := ioutil.WriteFile(fpath, []byte(data), 0644); err != nil {
+			test.Fatal("setup failed:", err)
+		}
+	}
+
+	defer func(strict bool) { config.Strict = strict }(config.Strict)
+	config.Strict = false
+	pages, err := LoadContentDir(tdir)
+	if err != nil {
+		test.Fatal("LoadContentDir failed for an invalid meta file without -strict:", err)
+	} else if len(pages) != len(files)-1 {
+		test.Errorf("LoadContentDir returned %d pages (should be %d)", len(pages), len(files)-1)
+	}
+
+	config.Strict = true
+	for _, dir := range []string{"bad", "blob", "rst"} {
+		if _, err = LoadContentDir(tdir); err == nil || !strings.Contains(err.Error(), dir) {
+			test.Errorf("LoadContentDir didn't fail for %s/ with -strict: %v", dir, err)
+		}
+		if err = os.RemoveAll(filepath.Join(tdir, dir)); err != nil {
+			test.Error(err)
+		}
+	}
+	if _, err = LoadContentDir(tdir); err != nil {
+		test.Error(err)
+	}
+
+	if err = os.RemoveAll(tdir); err != nil {
+		test.Error(err)
+	}
+}
+
+// TestDraftContent isn't parallel, since it sets the global `config.Drafts`.
+func TestDraftContent(test *testing.T) {
+	tdir := filepath.Join(os.TempDir(), "pagr_test", "TestDraftContent")
+	files := map[string]string{
+		"index.md":         "home",
+		"draft/meta.json":  `{"Draft": true}`,
+		"draft/index.md":   "draft",
+		"public/meta.toml": "Draft = false",
+		"public/index.md":  "public",
+	}
+	for fname, data := range files {
+		fpath := filepath.Join(tdir, fname)
+		if err := os.MkdirAll(filepath.Dir(fpath), 0775); err != nil {
+			test.Fatal("setup failed:", err)
+		}
+		if err := ioutil.WriteFile(fpath, []byte(data), 0644); err != nil {
+			test.Fatal("setup failed:", err)
+		}
+	}
+
+	defer func(drafts bool) { config.Drafts = drafts }(config.Drafts)
+	for _, drafts := range []bool{false, true} {
+		config.Drafts = drafts
+		pages, err := LoadContentDir(tdir)
+		if err != nil {
+			test.Fatal(err)
+		}
+		found := false
+		for _, p := range pages {
+			if p.Path == "/draft" {
+				found = true
+			}
+		}
+		if found != drafts {
+			test.Errorf("LoadContentDir returned the draft page: %t (Drafts is %t)", found, drafts)
+		} else if expect := len(files) - 3; !drafts && len(pages) != expect {
+			test.Errorf("LoadContentDir returned %d pages (should be %d)", len(pages), expect)
+		}
+	}
+
+	if err := os.RemoveAll(tdir); err != nil {
+		test.Error(err)
+	}
+}
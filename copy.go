@@ -1,70 +1,97 @@
 package main
 
-/*
-#include <stdio.h>
-#include <stdlib.h>
-
-// copyf copies data from file at `src` to the file at `dst`
-// in 4kb chunks`.
-// The file @ `src` *must* be **less than 2GB**. This is a
-// limitation of libc (staying portable).
-// Any existing file @ `dst` will be overwritten.
-// returns EXIT_SUCCESS or EXIT_FAILURE.
-int copyf(const char *src, const char *dst)
-{
-	int ret = EXIT_FAILURE;
-
-	FILE *srcf = fopen(src, "rb"), *dstf = fopen(dst, "wb");
-	if (!src || !dst) goto ABORT;
-
-	fseek(srcf, 0, SEEK_END);
-	size_t siz = ftell(srcf); // 2GB limit, returns long int
-	rewind(srcf);
-
-	char buf[4096]; // 4kb chunks
-	size_t r, w, total = 0;
-	while ((r = fread(buf, sizeof(char), sizeof(buf), srcf)) > 0) {
-		if (ferror(srcf)) goto ABORT;
-		w = fwrite(buf, sizeof(char), r, dstf);
-		if (ferror(dstf)) goto ABORT;
-		total += w;
-	}
-
-	if (total == siz) ret = EXIT_SUCCESS;
-
-ABORT:
-	if (srcf) fclose(srcf);
-	if (dstf) fclose(dstf);
-	return ret;
-}
-*/
-import "C"
 import (
 	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
 	"path/filepath"
-	"unsafe"
 )
 
-func copyFile(src, dst string) (err error) {
+// Copy modes, see `Config.CopyMode`.
+const (
+	CopyModeCopy     = "copy"
+	CopyModeHardlink = "hardlink"
+	CopyModeReflink  = "reflink"
+)
+
+// copyFile copies the data of the file at `src` (with the FileInfo `srcfi`)
+// to `dst`, replacing any existing file (which may be read-only or a hard
+// link). If `reflink` is true, the data is cloned (see `reflinkFile`) if the
+// filesystem supports it.
+// The permissions & modification time of `src` are set on `dst`.
+func copyFile(src, dst string, srcfi os.FileInfo, reflink bool) (err error) {
 	var srcf, dstf *os.File
 	if srcf, err = os.Open(src); err != nil {
 		return err
 	}
 	defer srcf.Close()
-	if dstf, err = os.OpenFile(dst, os.O_RDWR|os.O_CREATE, 0644); err != nil {
+	if err = os.Remove(dst); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if dstf, err = os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, srcfi.Mode().Perm()); err != nil {
 		return err
 	}
-	defer dstf.Close()
 
-	if _, err = io.Copy(dstf, srcf); err != nil {
+	if !reflink || reflinkFile(srcf, dstf) != nil {
+		if _, err = io.Copy(dstf, srcf); err == nil {
+			err = dstf.Sync()
+		}
+	}
+	if cerr := dstf.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
 		return err
 	}
-	return dstf.Sync()
+
+	if err = os.Chmod(dst, srcfi.Mode().Perm()); err == nil {
+		err = os.Chtimes(dst, srcfi.ModTime(), srcfi.ModTime())
+	}
+	return err
+}
+
+// replaceFile writes `data` to a temporary file in the directory of `fpath`
+// and renames it to `fpath`, so any existing file at `fpath` is replaced
+// rather than modified in place (it may be a hard link to a source file, see
+// `CopyFile`). All files written to `config.Output` should be written with it.
+func replaceFile(fpath string, data []byte, perm os.FileMode) (err error) {
+	var f *os.File
+	if f, err = ioutil.TempFile(filepath.Dir(fpath), "."+filepath.Base(fpath)+".*"); err != nil {
+		return
+	}
+	tmp := f.Name()
+	if _, err = f.Write(data); err == nil {
+		err = f.Chmod(perm)
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp, fpath)
+	}
+	if err != nil {
+		os.Remove(tmp)
+	}
+	return
+}
+
+// CopyFile copies the file at `src` to `dst`, if `dst` doesn't already
+// exist with the same size & modification time. How the file is copied is
+// set by `config.CopyMode`:
+//   - "copy" (default) copies the file data.
+//   - "hardlink" creates a hard link to `src` at `dst`, so `dst` must never
+//     be modified in place (see `replaceFile`). If a link can't be created,
+//     the data is copied.
+//   - "reflink" clones the file data (copy-on-write), on filesystems that
+//     support it (e.g. btrfs, xfs). Otherwise, the data is copied.
+func CopyFile(src, dst string) error {
+	return copyFileMode(src, dst, config.CopyMode)
 }
 
-func CopyFile(src, dst string) (err error) {
+// copyFileMode is `CopyFile`, using the copy `mode` rather than
+// `config.CopyMode`.
+func copyFileMode(src, dst, mode string) (err error) {
 	var srcfi, dstfi os.FileInfo
 
 	if srcfi, err = os.Stat(src); err != nil {
@@ -79,30 +106,36 @@ func CopyFile(src, dst string) (err error) {
 	} else if dstfi != nil && !dstfi.Mode().IsRegular() {
 		return fmt.Errorf("cannot copy to non-regular destination file %s (%q)",
 			dstfi.Name(), dstfi.Mode().String())
-	} else if os.SameFile(srcfi, dstfi) {
+	} else if dstfi != nil && os.SameFile(srcfi, dstfi) {
 		return nil
 	}
+	err = nil
+
+	// only copy if dst doesnt exist or has a different size/modtime
+	if dstfi != nil && srcfi.Size() == dstfi.Size() && srcfi.ModTime().Equal(dstfi.ModTime()) {
+		return
+	}
 
 	if err = os.MkdirAll(filepath.Dir(dst), 0777); err != nil {
 		return err
 	}
 
-	// only copy if dst doesnt exist or has different name/size/modtime
-	// and has a size less than 2GB (libc limit)
-	if dstfi == nil || srcfi.Name() != dstfi.Name() ||
-		srcfi.Size() != dstfi.Size() || srcfi.ModTime() != dstfi.ModTime() {
-		if srcfi.Size() > 2000000000 {
-			copyFile(src, dst)
-		} else {
-			cSrc := C.CString(src)
-			cDst := C.CString(dst)
-			if uint32(C.copyf(cSrc, cDst)) != 0 {
-				err = fmt.Errorf("copyf failed ('%s' -> '%s')", src, dst)
+	switch mode {
+	case CopyModeHardlink:
+		if dstfi != nil {
+			if err = os.Remove(dst); err != nil {
+				return err
 			}
-			C.free(unsafe.Pointer(cSrc))
-			C.free(unsafe.Pointer(cDst))
 		}
+		if os.Link(src, dst) == nil {
+			return nil
+		}
+		return copyFile(src, dst, srcfi, false)
+	case CopyModeReflink:
+		return copyFile(src, dst, srcfi, true)
+	case "", CopyModeCopy:
+		return copyFile(src, dst, srcfi, false)
+	default:
+		return fmt.Errorf("invalid copy mode '%s'", mode)
 	}
-
-	return
 }
@@ -0,0 +1,14 @@
+//go:build !linux
+// +build !linux
+
+package main
+
+import (
+	"errors"
+	"os"
+)
+
+// reflinkFile is only supported on linux, see copy_linux.go.
+func reflinkFile(src, dst *os.File) error {
+	return errors.New("reflinks are not supported on this platform")
+}
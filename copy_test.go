@@ -5,6 +5,7 @@ import (
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 )
 
 func TestCopyFile(test *testing.T) {
@@ -37,6 +38,74 @@ func TestCopyFile(test *testing.T) {
 		test.Fatalf("copied srcData (%s) does not match source (%s)", buf, srcData)
 	}
 
+	// overwrite a larger file, cloning the data if possible
+	if err := ioutil.WriteFile(dst, []byte("larger data"), 0666); err != nil {
+		test.Error("setup failed, could not write", dst)
+	}
+	mtime := time.Now().Add(-time.Hour).Truncate(time.Second)
+	if err := os.Chtimes(src, mtime, mtime); err != nil {
+		test.Error("setup failed:", err)
+	}
+	if err := os.Chmod(src, 0640); err != nil {
+		test.Error("setup failed:", err)
+	}
+	srcfi, _ := os.Stat(src)
+	if err := copyFile(src, dst, srcfi, true); err != nil {
+		test.Fatal("copyFile failed", err)
+	}
+	if buf, err := ioutil.ReadFile(dst); err != nil {
+		test.Errorf("could not read '%s'", dst)
+	} else if string(buf) != string(srcData) {
+		test.Errorf("copied data (%s) does not match source (%s)", buf, srcData)
+	}
+	if dstfi, err := os.Stat(dst); err != nil {
+		test.Errorf("could not stat '%s'", dst)
+	} else if !dstfi.ModTime().Equal(mtime) {
+		test.Errorf("modtime of '%s' (%s) does not match source (%s)", dst, dstfi.ModTime(), mtime)
+	} else if dstfi.Mode().Perm() != 0640 {
+		test.Errorf("permissions of '%s' (%s) do not match source", dst, dstfi.Mode())
+	}
+
+	// replace a read-only copy after the source changes
+	if err := os.Chmod(src, 0444); err != nil {
+		test.Error("setup failed:", err)
+	}
+	if err := CopyFile(src, dst); err != nil {
+		test.Fatal("CopyFile failed", err)
+	}
+	if err := os.Chmod(src, 0644); err != nil {
+		test.Error("setup failed:", err)
+	}
+	if err := ioutil.WriteFile(src, []byte("new data"), 0644); err != nil {
+		test.Error("setup failed:", err)
+	}
+	if err := os.Chmod(src, 0444); err != nil {
+		test.Error("setup failed:", err)
+	}
+	if err := CopyFile(src, dst); err != nil {
+		test.Fatal("CopyFile failed to replace a read-only file:", err)
+	} else if buf, err := ioutil.ReadFile(dst); err != nil || string(buf) != "new data" {
+		test.Errorf("read-only file wasn't replaced: '%s' (%v)", buf, err)
+	}
+
+	// hardlink
+	link := filepath.Join(tdir, "link")
+	if err := copyFileMode(src, link, CopyModeHardlink); err != nil {
+		test.Fatal("copyFileMode failed", err)
+	}
+	srcfi, _ = os.Stat(src)
+	if linkfi, err := os.Stat(link); err != nil {
+		test.Errorf("could not stat '%s'", link)
+	} else if !os.SameFile(srcfi, linkfi) {
+		test.Errorf("'%s' is not a hard link to '%s'", link, src)
+	}
+	if err := copyFileMode(src, filepath.Join(tdir, "invalid"), "symlink"); err == nil {
+		test.Error("copyFileMode didn't fail for an invalid copy mode")
+	}
+	if err := os.Chmod(src, 0644); err != nil {
+		test.Error(err)
+	}
+
 	if err := os.RemoveAll(tdir); err != nil {
 		test.Error(err)
 	}
@@ -0,0 +1,510 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Deploy target types, see `DeployTarget.Type`.
+const (
+	DeployDir   = "dir"
+	DeployRsync = "rsync"
+	DeployScp   = "scp"
+	DeployS3    = "s3"
+)
+
+// DeployTarget is a destination that `Config.Output` can be deployed to.
+type DeployTarget struct {
+	Name string
+	// Type is the kind of target: "dir", "rsync", "scp" or "s3".
+	Type string
+	// Dest is the destination directory for "dir" targets, or the remote
+	// destination ("[user@]host:path") for "rsync" and "scp" targets
+	// ("scp" targets transfer files with sftp, see `scpDeployer`).
+	Dest string
+	// Command overrides the command (and arguments) run for "rsync"
+	// targets, the source & destination paths are appended to it.
+	Command []string
+	// Endpoint, Bucket, Region & Prefix set the location of an "s3" target,
+	// objects are requested at "`Endpoint`/`Bucket`/`Prefix``path`".
+	Endpoint string
+	Bucket   string
+	Region   string
+	Prefix   string
+	// AccessKey and SecretKey are the credentials for an "s3" target, if
+	// empty the AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY environment
+	// variables are used.
+	AccessKey string
+	SecretKey string
+}
+
+// DeployDiff is the set of changes required to make a deploy target match
+// the local files, each is a slash-separated path relative to the root.
+type DeployDiff struct {
+	Upload []string
+	Delete []string
+}
+
+// hashDir returns the md5 sum (hex encoded) of every file in `root`, mapped
+// by it's slash-separated path relative to `root`. Files matching any of the
+// `keep` glob patterns (see `keepFile`) are skipped. If `root` doesn't
+// exist, an empty map is returned.
+func hashDir(root string, keep []string) (hashes map[string]string, err error) {
+	hashes = make(map[string]string)
+	if _, err = os.Stat(root); os.IsNotExist(err) {
+		return hashes, nil
+	}
+	err = filepath.Walk(root, func(fpath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(root, fpath)
+		if rel != "." && keepFile(rel, keep) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		} else if info.IsDir() {
+			return nil
+		}
+		var buf []byte
+		if buf, err = ioutil.ReadFile(fpath); err != nil {
+			return err
+		}
+		sum := md5.Sum(buf)
+		hashes[filepath.ToSlash(rel)] = hex.EncodeToString(sum[:])
+		return nil
+	})
+	return
+}
+
+// DiffFiles returns the changes required to make the `remote` files match
+// the `local` files (both map paths to a content hash). Remote paths
+// matching any `keep` glob pattern (see `keepFile`) are never deleted.
+func DiffFiles(local, remote map[string]string, keep []string) (diff DeployDiff) {
+	for p, hash := range local {
+		if remote[p] != hash {
+			diff.Upload = append(diff.Upload, p)
+		}
+	}
+	for p := range remote {
+		if _, ok := local[p]; !ok && !keepFile(p, keep) {
+			diff.Delete = append(diff.Delete, p)
+		}
+	}
+	sort.Strings(diff.Upload)
+	sort.Strings(diff.Delete)
+	return
+}
+
+// deployer is implemented by deploy targets that pagr diffs itself.
+type deployer interface {
+	// remote returns the content hash of each file on the target
+	remote() (map[string]string, error)
+	upload(root, rel string) error
+	remove(rel string) error
+	// done is called after a deploy of the `local` files succeeded
+	done(local map[string]string) error
+}
+
+// Deploy deploys the files in `root` to `t`, returning the changes made.
+// Files matching any of the `keep` glob patterns are never uploaded and
+// never deleted from the target. If `dryRun` is true, the changes are
+// returned but not made.
+func Deploy(t DeployTarget, root string, keep []string, dryRun bool) (diff DeployDiff, err error) {
+	var d deployer
+	switch t.Type {
+	case DeployDir:
+		d = dirDeployer{dest: t.Dest, keep: keep}
+	case DeployScp:
+		d = &scpDeployer{target: t, state: deployStatePath(root, t.Name)}
+	case DeployS3:
+		d = newS3Deployer(t)
+	case DeployRsync:
+		return diff, rsyncDeploy(t, root, keep, dryRun)
+	default:
+		return diff, fmt.Errorf("deploy target '%s' has an invalid type '%s'", t.Name, t.Type)
+	}
+
+	var local, remote map[string]string
+	if local, err = hashDir(root, keep); err != nil {
+		return
+	}
+	if remote, err = d.remote(); err != nil {
+		return
+	}
+	diff = DiffFiles(local, remote, keep)
+	if dryRun {
+		return
+	}
+
+	for _, rel := range diff.Upload {
+		if err = d.upload(root, rel); err != nil {
+			return
+		}
+	}
+	for _, rel := range diff.Delete {
+		if err = d.remove(rel); err != nil {
+			return
+		}
+	}
+	err = d.done(local)
+	return
+}
+
+// dirDeployer mirrors files to the local directory `dest`.
+type dirDeployer struct {
+	dest string
+	keep []string
+}
+
+func (d dirDeployer) remote() (map[string]string, error) {
+	return hashDir(d.dest, d.keep)
+}
+
+func (d dirDeployer) upload(root, rel string) error {
+	// remove dst first, it's content differs but the size & modtime may not
+	dst := filepath.Join(d.dest, filepath.FromSlash(rel))
+	if err := os.Remove(dst); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return CopyFile(filepath.Join(root, filepath.FromSlash(rel)), dst)
+}
+
+func (d dirDeployer) remove(rel string) error {
+	return RemoveStale(d.dest, []string{filepath.Join(d.dest, filepath.FromSlash(rel))})
+}
+
+func (d dirDeployer) done(map[string]string) error {
+	return nil
+}
+
+// rsyncDeploy runs rsync (or `t.Command`) to sync `root` to `t.Dest`,
+// rsync computes the changes itself. Unless `t.Command` is set, files
+// matching the `keep` glob patterns are excluded (so they're never uploaded
+// or deleted).
+func rsyncDeploy(t DeployTarget, root string, keep []string, dryRun bool) error {
+	args := t.Command
+	if len(args) == 0 {
+		args = []string{"rsync", "--recursive", "--links", "--times", "--checksum", "--delete", "--verbose"}
+		for _, pattern := range keep {
+			args = append(args, "--exclude="+pattern)
+		}
+	}
+	if dryRun {
+		args = append(args, "--dry-run")
+	}
+	args = append(args, strings.TrimSuffix(root, string(filepath.Separator))+string(filepath.Separator), t.Dest)
+	return runDeployCommand(args...)
+}
+
+func runDeployCommand(args ...string) error {
+	vlog("$ %s", strings.Join(args, " "))
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+// deployStatePath returns the path of the file that the state of the last
+// deploy of `root` to the target `name` is kept in.
+func deployStatePath(root, name string) string {
+	root = filepath.Clean(root)
+	return filepath.Join(filepath.Dir(root), "."+filepath.Base(root)+".deploy-"+name+".json")
+}
+
+// scpDeployer transfers files over SSH, with a batch of sftp commands (so
+// paths are never interpreted by a remote shell). Since the remote files
+// can't be hashed, they're diffed against the files recorded in the `state`
+// file by the last deploy: files changed or removed on the remote host by
+// anything else aren't detected.
+type scpDeployer struct {
+	target DeployTarget
+	state  string
+	batch  []string        // sftp commands, run by `done`
+	dirs   map[string]bool // remote directories created in `batch`
+}
+
+func (d *scpDeployer) hostPath() (host, dir string) {
+	if i := strings.IndexByte(d.target.Dest, ':'); i != -1 {
+		return d.target.Dest[:i], d.target.Dest[i+1:]
+	}
+	return d.target.Dest, "."
+}
+
+// sftpQuote returns `s` quoted as a single argument of an sftp batch
+// command, glob characters in it are matched literally.
+func sftpQuote(s string) (string, error) {
+	if strings.ContainsAny(s, "\r\n") {
+		return "", fmt.Errorf("invalid path for sftp: %q", s)
+	}
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`, nil
+}
+
+func (d *scpDeployer) remote() (hashes map[string]string, err error) {
+	hashes = make(map[string]string)
+	var buf []byte
+	if buf, err = ioutil.ReadFile(d.state); os.IsNotExist(err) {
+		return hashes, nil
+	} else if err == nil {
+		err = json.Unmarshal(buf, &hashes)
+	}
+	return
+}
+
+func (d *scpDeployer) upload(root, rel string) error {
+	_, dir := d.hostPath()
+	dst := path.Join(dir, rel)
+	if d.dirs == nil {
+		d.dirs = make(map[string]bool)
+	}
+	var mkdirs []string
+	for p := path.Dir(dst); p != "." && p != "/" && !d.dirs[p]; p = path.Dir(p) {
+		d.dirs[p] = true
+		mkdirs = append([]string{p}, mkdirs...)
+	}
+	for _, p := range mkdirs {
+		qp, err := sftpQuote(p)
+		if err != nil {
+			return err
+		}
+		d.batch = append(d.batch, "-mkdir "+qp) // "-" ignores existing directories
+	}
+
+	src, err := sftpQuote(filepath.Join(root, filepath.FromSlash(rel)))
+	if err != nil {
+		return err
+	}
+	qdst, err := sftpQuote(dst)
+	if err == nil {
+		d.batch = append(d.batch, "put -p "+src+" "+qdst)
+	}
+	return err
+}
+
+func (d *scpDeployer) remove(rel string) error {
+	_, dir := d.hostPath()
+	dst, err := sftpQuote(path.Join(dir, rel))
+	if err == nil {
+		d.batch = append(d.batch, "-rm "+dst)
+	}
+	return err
+}
+
+func (d *scpDeployer) done(local map[string]string) (err error) {
+	if len(d.batch) > 0 {
+		host, _ := d.hostPath()
+		vlog("$ sftp -b - %s <<\n%s", host, strings.Join(d.batch, "\n"))
+		cmd := exec.Command("sftp", "-b", "-", host)
+		cmd.Stdin = strings.NewReader(strings.Join(d.batch, "\n") + "\n")
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		if err = cmd.Run(); err != nil {
+			return
+		}
+	}
+	var buf []byte
+	if buf, err = json.MarshalIndent(local, "", "\t"); err == nil {
+		err = ioutil.WriteFile(d.state, buf, 0644)
+	}
+	return
+}
+
+// s3Deployer uploads files to an S3-compatible bucket, requests are
+// signed with AWS Signature Version 4.
+type s3Deployer struct {
+	DeployTarget
+	client *http.Client
+	now    func() time.Time
+}
+
+func newS3Deployer(t DeployTarget) *s3Deployer {
+	if len(t.Region) == 0 {
+		t.Region = "us-east-1"
+	}
+	if len(t.AccessKey) == 0 {
+		t.AccessKey = os.Getenv("AWS_ACCESS_KEY_ID")
+	}
+	if len(t.SecretKey) == 0 {
+		t.SecretKey = os.Getenv("AWS_SECRET_ACCESS_KEY")
+	}
+	if t.Prefix = strings.Trim(t.Prefix, "/"); len(t.Prefix) > 0 {
+		t.Prefix += "/"
+	}
+	return &s3Deployer{DeployTarget: t, client: http.DefaultClient, now: time.Now}
+}
+
+// s3Escape URI-encodes `s` as required by AWS Signature Version 4, if
+// `path` is true then '/' is not encoded.
+func s3Escape(s string, path bool) string {
+	var out strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') ||
+			c == '-' || c == '_' || c == '.' || c == '~' || (path && c == '/') {
+			out.WriteByte(c)
+		} else {
+			fmt.Fprintf(&out, "%%%02X", c)
+		}
+	}
+	return out.String()
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// sign sets the AWS Signature Version 4 headers on `req`, where
+// `payloadHash` is the hex encoded sha256 sum of the request body.
+func (d *s3Deployer) sign(req *http.Request, payloadHash string) {
+	now := d.now().UTC()
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	req.Header.Set("x-amz-date", amzDate)
+	req.Header.Set("x-amz-content-sha256", payloadHash)
+
+	var query []string
+	for k, vs := range req.URL.Query() {
+		for _, v := range vs {
+			query = append(query, s3Escape(k, false)+"="+s3Escape(v, false))
+		}
+	}
+	sort.Strings(query)
+
+	signed := "host;x-amz-content-sha256;x-amz-date"
+	canonical := strings.Join([]string{
+		req.Method,
+		s3Escape(req.URL.Path, true),
+		strings.Join(query, "&"),
+		"host:" + req.URL.Host + "\n" +
+			"x-amz-content-sha256:" + payloadHash + "\n" +
+			"x-amz-date:" + amzDate + "\n",
+		signed,
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + d.Region + "/s3/aws4_request"
+	canonicalHash := sha256.Sum256([]byte(canonical))
+	toSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(canonicalHash[:])
+
+	key := hmacSHA256([]byte("AWS4"+d.SecretKey), date)
+	key = hmacSHA256(key, d.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, toSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		d.AccessKey, scope, signed, signature))
+}
+
+// do sends a signed request for the object `key` (or the bucket, if empty).
+func (d *s3Deployer) do(method, key string, query url.Values, body []byte, contentType string) (resp *http.Response, err error) {
+	u := strings.TrimSuffix(d.Endpoint, "/") + "/" + d.Bucket
+	if len(key) > 0 {
+		u += "/" + s3Escape(key, true)
+	}
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+
+	var req *http.Request
+	if req, err = http.NewRequest(method, u, bytes.NewReader(body)); err != nil {
+		return
+	}
+	if len(contentType) > 0 {
+		req.Header.Set("Content-Type", contentType)
+	}
+	sum := sha256.Sum256(body)
+	d.sign(req, hex.EncodeToString(sum[:]))
+
+	if resp, err = d.client.Do(req); err == nil && resp.StatusCode >= 300 {
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+		resp.Body.Close()
+		err = fmt.Errorf("%s %s: %s %s", method, u, resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return
+}
+
+type s3ListBucketResult struct {
+	Contents []struct {
+		Key  string
+		ETag string
+	}
+	IsTruncated           bool
+	NextContinuationToken string
+}
+
+// remote lists the objects under `d.Prefix` with ListObjectsV2, the ETag of
+// each is used as it's hash (it's the md5 sum of objects not uploaded in parts).
+func (d *s3Deployer) remote() (hashes map[string]string, err error) {
+	hashes = make(map[string]string)
+	query := url.Values{"list-type": {"2"}, "prefix": {d.Prefix}}
+	for {
+		var resp *http.Response
+		if resp, err = d.do(http.MethodGet, "", query, nil, ""); err != nil {
+			return
+		}
+		var result s3ListBucketResult
+		err = xml.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if err != nil {
+			return
+		}
+
+		for _, obj := range result.Contents {
+			hashes[strings.TrimPrefix(obj.Key, d.Prefix)] = strings.Trim(obj.ETag, `"`)
+		}
+		if !result.IsTruncated || len(result.NextContinuationToken) == 0 {
+			return
+		}
+		query.Set("continuation-token", result.NextContinuationToken)
+	}
+}
+
+func (d *s3Deployer) upload(root, rel string) (err error) {
+	var buf []byte
+	if buf, err = ioutil.ReadFile(filepath.Join(root, filepath.FromSlash(rel))); err != nil {
+		return
+	}
+	contentType := mime.TypeByExtension(path.Ext(rel))
+	if len(contentType) == 0 {
+		contentType = http.DetectContentType(buf)
+	}
+	var resp *http.Response
+	if resp, err = d.do(http.MethodPut, d.Prefix+rel, nil, buf, contentType); err == nil {
+		resp.Body.Close()
+	}
+	return
+}
+
+func (d *s3Deployer) remove(rel string) (err error) {
+	var resp *http.Response
+	if resp, err = d.do(http.MethodDelete, d.Prefix+rel, nil, nil, ""); err == nil {
+		resp.Body.Close()
+	}
+	return
+}
+
+func (d *s3Deployer) done(map[string]string) error {
+	return nil
+}
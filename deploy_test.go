@@ -0,0 +1,174 @@
+package main
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/xml"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func writeDeployFiles(test *testing.T, root string, files map[string]string) {
+	for fname, data := range files {
+		fpath := filepath.Join(root, filepath.FromSlash(fname))
+		if err := os.MkdirAll(filepath.Dir(fpath), 0775); err != nil {
+			test.Fatal("setup failed:", err)
+		}
+		if err := ioutil.WriteFile(fpath, []byte(data), 0644); err != nil {
+			test.Fatal("setup failed:", err)
+		}
+	}
+}
+
+func TestDeployDir(test *testing.T) {
+	test.Parallel()
+
+	tdir := filepath.Join(os.TempDir(), "pagr_test", "TestDeployDir")
+	out, dest := filepath.Join(tdir, "out"), filepath.Join(tdir, "dest")
+	writeDeployFiles(test, out, map[string]string{"index.html": "new", "a/index.html": "same", "b.css": "b", ".git/HEAD": "ref"})
+	writeDeployFiles(test, dest, map[string]string{"index.html": "old", "a/index.html": "same", "c/index.html": "c", "CNAME": "x"})
+
+	t := DeployTarget{Name: "mirror", Type: DeployDir, Dest: dest}
+	diff, err := Deploy(t, out, []string{"CNAME", ".git"}, false)
+	if err != nil {
+		test.Fatal(err)
+	}
+	if strings.Join(diff.Upload, ",") != "b.css,index.html" {
+		test.Errorf("Deploy uploaded %v", diff.Upload)
+	}
+	if strings.Join(diff.Delete, ",") != "c/index.html" {
+		test.Errorf("Deploy deleted %v", diff.Delete)
+	}
+
+	local, _ := hashDir(out, []string{".git"})
+	remote, _ := hashDir(dest, nil)
+	if diff = DiffFiles(local, remote, []string{"CNAME"}); len(diff.Upload) > 0 || len(diff.Delete) > 0 {
+		test.Errorf("destination does not match output after Deploy: %+v", diff)
+	}
+	if _, err = os.Stat(filepath.Join(dest, ".git")); err == nil {
+		test.Error("kept file was deployed")
+	}
+
+	if err = os.RemoveAll(tdir); err != nil {
+		test.Error(err)
+	}
+}
+
+func TestDeployScp(test *testing.T) {
+	test.Parallel()
+
+	d := &scpDeployer{target: DeployTarget{Name: "ssh", Type: DeployScp, Dest: "user@host:www"}}
+	for _, rel := range []string{"a b/index.html", "a b/c/x.css", "$(rm -rf ~)/\"*.html"} {
+		if err := d.upload("out", rel); err != nil {
+			test.Fatal(err)
+		}
+	}
+	if err := d.remove("old; ls.html"); err != nil {
+		test.Fatal(err)
+	}
+	if err := d.remove("new\nline"); err == nil {
+		test.Error("remove didn't fail for a path with a newline")
+	}
+
+	expect := []string{
+		`-mkdir "www"`,
+		`-mkdir "www/a b"`,
+		`put -p "out/a b/index.html" "www/a b/index.html"`,
+		`-mkdir "www/a b/c"`,
+		`put -p "out/a b/c/x.css" "www/a b/c/x.css"`,
+		`-mkdir "www/$(rm -rf ~)"`,
+		`put -p "out/$(rm -rf ~)/\"*.html" "www/$(rm -rf ~)/\"*.html"`,
+		`-rm "www/old; ls.html"`,
+	}
+	if strings.Join(d.batch, "\n") != strings.Join(expect, "\n") {
+		test.Errorf("invalid sftp batch:\n%s\nshould be:\n%s", strings.Join(d.batch, "\n"), strings.Join(expect, "\n"))
+	}
+}
+
+// fakeS3 is a minimal S3-compatible server storing objects in memory.
+type fakeS3 struct {
+	sync.Mutex
+	objects map[string]string
+	puts    []string
+}
+
+func (s *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.Lock()
+	defer s.Unlock()
+
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=key/") {
+		http.Error(w, "missing signature", http.StatusForbidden)
+		return
+	}
+	key := strings.TrimPrefix(r.URL.Path, "/bucket/")
+	switch r.Method {
+	case http.MethodGet:
+		type object struct{ Key, ETag string }
+		var result struct {
+			XMLName  xml.Name `xml:"ListBucketResult"`
+			Contents []object
+		}
+		var keys []string
+		for k := range s.objects {
+			if strings.HasPrefix(k, r.URL.Query().Get("prefix")) {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			sum := md5.Sum([]byte(s.objects[k]))
+			result.Contents = append(result.Contents, object{k, `"` + hex.EncodeToString(sum[:]) + `"`})
+		}
+		xml.NewEncoder(w).Encode(result)
+	case http.MethodPut:
+		buf, _ := ioutil.ReadAll(r.Body)
+		s.objects[key] = string(buf)
+		s.puts = append(s.puts, key)
+	case http.MethodDelete:
+		delete(s.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func TestDeployS3(test *testing.T) {
+	test.Parallel()
+
+	tdir := filepath.Join(os.TempDir(), "pagr_test", "TestDeployS3")
+	writeDeployFiles(test, tdir, map[string]string{"index.html": "new", "a b/index.html": "same"})
+
+	s3 := &fakeS3{objects: map[string]string{
+		"site/index.html":     "old",
+		"site/a b/index.html": "same",
+		"site/gone.html":      "gone",
+		"other/index.html":    "other",
+	}}
+	server := httptest.NewServer(s3)
+	defer server.Close()
+
+	t := DeployTarget{Name: "s3", Type: DeployS3, Endpoint: server.URL, Bucket: "bucket",
+		Prefix: "/site", AccessKey: "key", SecretKey: "secret"}
+	diff, err := Deploy(t, tdir, nil, false)
+	if err != nil {
+		test.Fatal(err)
+	}
+	if strings.Join(diff.Upload, ",") != "index.html" || strings.Join(s3.puts, ",") != "site/index.html" {
+		test.Errorf("Deploy uploaded %v (%v)", diff.Upload, s3.puts)
+	}
+	if strings.Join(diff.Delete, ",") != "gone.html" {
+		test.Errorf("Deploy deleted %v", diff.Delete)
+	}
+	if s3.objects["site/index.html"] != "new" || len(s3.objects) != 3 {
+		test.Errorf("invalid objects after Deploy: %v", s3.objects)
+	}
+
+	if err = os.RemoveAll(tdir); err != nil {
+		test.Error(err)
+	}
+}
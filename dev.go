@@ -0,0 +1,239 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	hmpl "html/template"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	tmpl "text/template"
+	"time"
+
+	"notabug.org/gearsix/suti"
+)
+
+// watchInterval is how often files are checked for changes when serving.
+const watchInterval = time.Second
+
+// snippetContext is the number of lines shown either side of the line a
+// template error occurred on.
+const snippetContext = 3
+
+// TemplateError is a template parse or execution error, with the location
+// it occurred at.
+type TemplateError struct {
+	Template string // name of the template the error occurred in
+	File     string // the file `Template` was loaded from, if found
+	Line     int
+	Column   int
+	DataPath string // the data being evaluated, for execution errors (e.g. ".Meta.Title")
+	Message  string
+	Snippet  []SnippetLine // lines around `Line` in `File`
+}
+
+// SnippetLine is a line of a template file shown in a TemplateError.
+type SnippetLine struct {
+	Number int
+	Text   string
+	Error  bool // true if it's the line the error occurred on
+}
+
+func (e *TemplateError) Error() string {
+	loc := e.File
+	if len(loc) == 0 {
+		loc = e.Template
+	}
+	if e.Line > 0 {
+		loc += ":" + strconv.Itoa(e.Line)
+		if e.Column > 0 {
+			loc += ":" + strconv.Itoa(e.Column)
+		}
+	}
+	if len(e.DataPath) > 0 {
+		return fmt.Sprintf("%s: at <%s>: %s", loc, e.DataPath, e.Message)
+	}
+	return fmt.Sprintf("%s: %s", loc, e.Message)
+}
+
+// templateErrorRegexp matches the errors returned by "text/template" and
+// "html/template", e.g.
+// `template: page:3:8: executing "page" at <.Meta.Title>: message`.
+var templateErrorRegexp = regexp.MustCompile(`(?:html/)?template: ?([^:\s]+):(\d+):(?:(\d+):)?\s*(?:executing "[^"]*" at <([^>]*)>: )?(.*)`)
+
+// NewTemplateError returns `err` as a TemplateError, finding the template
+// file it occurred in within the templates directories `dirs` (see
+// `LoadTemplateDir`). If `err` is not a template error, only `Message` is set.
+func NewTemplateError(err error, dirs ...string) *TemplateError {
+	terr := &TemplateError{Message: err.Error()}
+	m := templateErrorRegexp.FindStringSubmatch(err.Error())
+	if m == nil {
+		return terr
+	}
+	terr.Template = m[1]
+	terr.Line, _ = strconv.Atoi(m[2])
+	terr.Column, _ = strconv.Atoi(m[3])
+	terr.DataPath = m[4]
+	terr.Message = m[5]
+	if terr.File = findTemplateFile(dirs, terr.Template); len(terr.File) > 0 {
+		terr.Snippet = templateSnippet(terr.File, terr.Line)
+	}
+	return terr
+}
+
+// findTemplateFile returns the path of the file in `dirs` that the template
+// `name` was parsed from. Templates that declare a layout are parsed from
+// the layout file, and from their own file as "`name`.page" (see
+// `loadLayoutTemplate`).
+func findTemplateFile(dirs []string, name string) (found string) {
+	page := strings.HasSuffix(name, ".page")
+	name = strings.TrimSuffix(name, ".page")
+	files, rels, err := overlayFiles(existingDirs(dirs))
+	if err != nil {
+		return
+	}
+	for _, rel := range rels {
+		lang := strings.TrimPrefix(filepath.Ext(rel), ".")
+		if suti.IsSupportedTemplateLang(lang) != -1 && templateName(rel) == name {
+			found = files[rel]
+			break
+		}
+	}
+
+	if len(found) > 0 && !page {
+		if src, err := ioutil.ReadFile(found); err == nil {
+			if layout := templateLayout(src); len(layout) > 0 {
+				if layoutPath, ok := files[filepath.Join(layoutsDir, layout+filepath.Ext(found))]; ok {
+					found = layoutPath
+				}
+			}
+		}
+	}
+	return
+}
+
+// templateSnippet returns the lines of the file at `fpath` within
+// `snippetContext` lines of `line`.
+func templateSnippet(fpath string, line int) (snippet []SnippetLine) {
+	buf, err := ioutil.ReadFile(fpath)
+	if err != nil || line < 1 {
+		return
+	}
+	lines := strings.Split(strings.TrimSuffix(string(buf), "\n"), "\n")
+	for n := line - snippetContext; n <= line+snippetContext; n++ {
+		if n < 1 || n > len(lines) {
+			continue
+		}
+		snippet = append(snippet, SnippetLine{Number: n, Text: lines[n-1], Error: n == line})
+	}
+	return
+}
+
+var errorPage = hmpl.Must(hmpl.New("error").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>pagr: template error</title>
+<style>
+body { font-family: sans-serif; margin: 2em; color: #222; }
+pre { background: #f4f4f4; padding: 1em; overflow: auto; }
+.error { background: #fdd; font-weight: bold; }
+</style>
+</head>
+<body>
+<h1>Template error</h1>
+<p><code>{{.File}}{{if .Line}}:{{.Line}}{{if .Column}}:{{.Column}}{{end}}{{end}}</code>{{if .Template}} (template "{{.Template}}"){{end}}</p>
+{{if .DataPath}}<p>at <code>{{.DataPath}}</code></p>{{end}}
+<pre>{{.Message}}</pre>
+{{if .Snippet}}<pre>{{range .Snippet}}<span{{if .Error}} class="error"{{end}}>{{printf "%4d" .Number}} | {{.Text}}</span>
+{{end}}</pre>{{end}}
+</body>
+</html>
+`))
+
+// WriteErrorPage writes `terr` to `w` as an HTML page.
+func WriteErrorPage(w io.Writer, terr *TemplateError) error {
+	return errorPage.Execute(w, terr)
+}
+
+func writeErrorPageFile(fpath string, terr *TemplateError) (err error) {
+	var buf bytes.Buffer
+	if err = WriteErrorPage(&buf, terr); err == nil {
+		if err = os.MkdirAll(filepath.Dir(fpath), 0755); err == nil {
+			err = replaceFile(fpath, buf.Bytes(), 0644)
+		}
+	}
+	return
+}
+
+// errorPageTemplate returns a template named `name` that renders `terr`
+// as an HTML page, for any data it's executed with.
+func errorPageTemplate(name string, terr *TemplateError) (t suti.Template, err error) {
+	var buf bytes.Buffer
+	if err = WriteErrorPage(&buf, terr); err != nil {
+		return
+	}
+	page := buf.String()
+	t.Name = name
+	t.T, err = tmpl.New(name).Funcs(map[string]interface{}{
+		"errorPage": func() string { return page },
+	}).Parse("{{errorPage}}")
+	return
+}
+
+// LoadDevTemplateDir loads the templates in `dirs` like `LoadTemplateDir`,
+// except templates that fail to load are replaced with an
+// `errorPageTemplate` and their error is returned in `terrs`.
+func LoadDevTemplateDir(dirs ...string) (templates []suti.Template, terrs []*TemplateError, err error) {
+	templates, err = loadTemplateDir(dirs, func(rootPath string, e error) (suti.Template, error) {
+		terr := NewTemplateError(e, dirs...)
+		if len(terr.File) == 0 {
+			terr.File = rootPath
+		}
+		terrs = append(terrs, terr)
+		return errorPageTemplate(templateName(rootPath), terr)
+	})
+	return
+}
+
+// dirWatcher polls the files in `dirs` for changes.
+type dirWatcher struct {
+	dirs   []string
+	mtimes map[string]time.Time
+}
+
+func newDirWatcher(dirs ...string) *dirWatcher {
+	w := &dirWatcher{dirs: dirs}
+	w.Changed()
+	return w
+}
+
+// Changed returns the paths of all files in `w.dirs` that were created,
+// modified or removed since it was last called.
+func (w *dirWatcher) Changed() (changed []string) {
+	mtimes := make(map[string]time.Time)
+	for _, dir := range w.dirs {
+		filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+			if err == nil && !info.IsDir() {
+				mtimes[path] = info.ModTime()
+			}
+			return nil
+		})
+	}
+	for path, mtime := range mtimes {
+		if prev, ok := w.mtimes[path]; !ok || !prev.Equal(mtime) {
+			changed = append(changed, path)
+		}
+	}
+	for path := range w.mtimes {
+		if _, ok := mtimes[path]; !ok {
+			changed = append(changed, path)
+		}
+	}
+	w.mtimes = mtimes
+	return
+}
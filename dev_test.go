@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTemplateErrors(test *testing.T) {
+	test.Parallel()
+
+	tdir := filepath.Join(os.TempDir(), "pagr_test", "TestTemplateErrors")
+	files := map[string]string{
+		"good.hmpl":         `<p>{{.Path}}</p>`,
+		"exec.hmpl":         "line 1\n{{.Meta.Title.Missing}}\nline 3\n",
+		"broken.tmpl":       "line 1\nline 2\n{{if .Path}}\n",
+		"blog.hmpl":         "{{/* layout \"base\" */}}\n{{define \"main\"}}{{.Path}}{{end}}\n",
+		"layouts/base.hmpl": "<html>\n{{block \"main\" .}}{{end}}\n{{bad}}\n</html>\n",
+	}
+	for fname, data := range files {
+		fpath := filepath.Join(tdir, fname)
+		if err := os.MkdirAll(filepath.Dir(fpath), 0775); err != nil {
+			test.Fatal("setup failed:", err)
+		}
+		if err := ioutil.WriteFile(fpath, []byte(data), 0644); err != nil {
+			test.Fatal("setup failed:", err)
+		}
+	}
+
+	if _, err := LoadTemplateDir(tdir); err == nil {
+		test.Fatal("LoadTemplateDir didn't fail for broken templates")
+	}
+	templates, terrs, err := LoadDevTemplateDir(tdir)
+	if err != nil {
+		test.Fatal(err)
+	} else if len(templates) != 4 {
+		test.Fatalf("LoadDevTemplateDir loaded %d templates (should be 4)", len(templates))
+	} else if len(terrs) != 2 {
+		test.Fatalf("LoadDevTemplateDir returned %d errors (should be 2)", len(terrs))
+	}
+
+	p := NewPage("/test", time.Now())
+	for _, t := range templates {
+		switch t.Name {
+		case "broken", "blog":
+			buf, err := t.Execute(p)
+			if err != nil {
+				test.Fatal(err)
+			} else if !strings.Contains(buf.String(), "<h1>Template error</h1>") {
+				test.Errorf("%s template didn't render an error page:\n%s", t.Name, buf.String())
+			}
+		case "exec":
+			_, err := t.Execute(p)
+			if err == nil {
+				test.Fatal("exec template didn't fail")
+			}
+			terr := NewTemplateError(err, tdir)
+			if terr.File != filepath.Join(tdir, "exec.hmpl") || terr.Line != 2 || terr.DataPath != ".Meta.Title.Missing" {
+				test.Errorf("invalid TemplateError for '%s': %+v", err, terr)
+			}
+			if len(terr.Snippet) != 3 || !terr.Snippet[1].Error || terr.Snippet[1].Text != "{{.Meta.Title.Missing}}" {
+				test.Errorf("invalid TemplateError Snippet: %+v", terr.Snippet)
+			}
+			var page bytes.Buffer
+			if err = WriteErrorPage(&page, terr); err != nil {
+				test.Fatal(err)
+			} else if !strings.Contains(page.String(), "<code>.Meta.Title.Missing</code>") {
+				test.Errorf("error page doesn't contain the data path:\n%s", page.String())
+			}
+		}
+	}
+
+	for _, terr := range terrs {
+		var expect string
+		switch terr.Template {
+		case "broken":
+			expect = filepath.Join(tdir, "broken.tmpl")
+		case "blog":
+			expect = filepath.Join(tdir, "layouts", "base.hmpl")
+		}
+		if terr.File != expect {
+			test.Errorf("TemplateError File for %s is '%s' (should be '%s')", terr.Template, terr.File, expect)
+		}
+	}
+
+	if err = os.RemoveAll(tdir); err != nil {
+		test.Error(err)
+	}
+}
+
+func TestDirWatcher(test *testing.T) {
+	test.Parallel()
+
+	tdir := filepath.Join(os.TempDir(), "pagr_test", "TestDirWatcher")
+	fpath := filepath.Join(tdir, "a.hmpl")
+	if err := os.MkdirAll(tdir, 0775); err != nil {
+		test.Fatal("setup failed:", err)
+	}
+	if err := ioutil.WriteFile(fpath, []byte("a"), 0644); err != nil {
+		test.Fatal("setup failed:", err)
+	}
+
+	w := newDirWatcher(tdir)
+	if changed := w.Changed(); len(changed) != 0 {
+		test.Errorf("Changed returned %v for unchanged files", changed)
+	}
+	if err := os.Chtimes(fpath, time.Now(), time.Now().Add(time.Minute)); err != nil {
+		test.Fatal(err)
+	}
+	if changed := w.Changed(); len(changed) != 1 || changed[0] != fpath {
+		test.Errorf("Changed returned %v for a modified file (should be [%s])", changed, fpath)
+	}
+	if err := os.Remove(fpath); err != nil {
+		test.Fatal(err)
+	}
+	if changed := w.Changed(); len(changed) != 1 || changed[0] != fpath {
+		test.Errorf("Changed returned %v for a removed file (should be [%s])", changed, fpath)
+	}
+
+	if err := os.RemoveAll(tdir); err != nil {
+		test.Error(err)
+	}
+}
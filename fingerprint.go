@@ -0,0 +1,141 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Manifest maps the logical URL path of fingerprinted assets (e.g.
+// "/css/style.css") to their fingerprinted URL path ("/css/style.3f2a9c.css").
+type Manifest map[string]string
+
+// manifest is the Manifest of all assets fingerprinted in the current build.
+var manifest = make(Manifest)
+
+const fingerprintLength = 6
+
+// hashFile returns the hex encoded sha256 sum of the file at `fpath`.
+func hashFile(fpath string) (hash string, err error) {
+	var f *os.File
+	if f, err = os.Open(fpath); err != nil {
+		return
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err = io.Copy(h, f); err == nil {
+		hash = hex.EncodeToString(h.Sum(nil))
+	}
+	return
+}
+
+// fingerprintName returns `url` with the first characters of `hash`
+// inserted before the file extension.
+func fingerprintName(url, hash string) string {
+	if len(hash) > fingerprintLength {
+		hash = hash[:fingerprintLength]
+	}
+	ext := path.Ext(url)
+	return strings.TrimSuffix(url, ext) + "." + hash + ext
+}
+
+// Add sets the fingerprinted URL for `url` (the URL path of a file with
+// the content hash `hash`) in `m` and returns it.
+func (m Manifest) Add(url, hash string) string {
+	url = "/" + strings.TrimPrefix(filepath.ToSlash(url), "/")
+	m[url] = fingerprintName(url, hash)
+	return m[url]
+}
+
+// URL returns the fingerprinted URL of the logical URL path `url`. If `url`
+// is not in `m`, it's returned unchanged.
+func (m Manifest) URL(url string) string {
+	if hashed, ok := m["/"+strings.TrimPrefix(url, "/")]; ok {
+		return hashed
+	}
+	return url
+}
+
+// assetURL returns the fingerprinted URL of the asset at the logical path
+// `url`, prefixed with `config.BasePath`. It's available to templates as "asset".
+func assetURL(url string) string {
+	return joinURL(config.BasePath, manifest.URL(url))
+}
+
+var urlAttrRegexp = regexp.MustCompile(`(?i)(\s(?:href|src)\s*=\s*["']?)([^"'\s>]+)`)
+var cssURLRegexp = regexp.MustCompile(`(?i)(\burl\(\s*["']?)([^"'\s)]+)`)
+
+// Rewrite replaces any href/src attribute values in `html` (or url() values,
+// if `css` is true) that point to a logical URL in `m` with it's
+// fingerprinted URL. Absolute paths are only matched if they're prefixed
+// with the base path `base`, relative paths are resolved against the URL
+// path `dir` of the directory the file is written to (and stay relative).
+func (m Manifest) Rewrite(html []byte, base, dir string, css bool) []byte {
+	re := urlAttrRegexp
+	if css {
+		re = cssURLRegexp
+	}
+	base = strings.TrimSuffix(base, "/")
+	return re.ReplaceAllFunc(html, func(match []byte) []byte {
+		sub := re.FindSubmatch(match)
+		if link, ok := m.rewriteLink(string(sub[2]), base, dir); ok {
+			return []byte(string(sub[1]) + link)
+		}
+		return match
+	})
+}
+
+// rewriteLink returns the fingerprinted URL of `link` (see `m.Rewrite`)
+// and true, or false if it's not in `m`.
+func (m Manifest) rewriteLink(link, base, dir string) (string, bool) {
+	var suffix string
+	if i := strings.IndexAny(link, "?#"); i != -1 {
+		link, suffix = link[:i], link[i:]
+	}
+	switch {
+	case len(link) == 0 || strings.HasPrefix(link, "//") || strings.Contains(link, ":"):
+		// another host, or a scheme (e.g. "https:", "data:")
+	case strings.HasPrefix(link, "/"):
+		if !strings.HasPrefix(link, base+"/") {
+			break
+		}
+		if hashed, ok := m[strings.TrimPrefix(link, base)]; ok {
+			return base + hashed + suffix, true
+		}
+	default:
+		if hashed, ok := m[path.Join("/", dir, link)]; ok {
+			return strings.TrimSuffix(link, path.Base(link)) + path.Base(hashed) + suffix, true
+		}
+	}
+	return "", false
+}
+
+// RewriteFile calls `m.Rewrite` on the contents of the HTML or CSS file at
+// `fpath`, which is written to the URL path directory `dir`.
+func (m Manifest) RewriteFile(fpath, base, dir string) (err error) {
+	css := strings.ToLower(filepath.Ext(fpath)) == ".css"
+	var buf []byte
+	if buf, err = ioutil.ReadFile(fpath); err == nil {
+		err = replaceFile(fpath, m.Rewrite(buf, base, dir, css), 0644)
+	}
+	return
+}
+
+// Write writes `m` as JSON to the file at `fpath`.
+func (m Manifest) Write(fpath string) (err error) {
+	var buf []byte
+	if buf, err = json.MarshalIndent(m, "", "\t"); err == nil {
+		if err = os.MkdirAll(filepath.Dir(fpath), 0755); err == nil {
+			err = replaceFile(fpath, buf, 0644)
+		}
+	}
+	return
+}
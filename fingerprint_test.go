@@ -0,0 +1,56 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestManifest(test *testing.T) {
+	test.Parallel()
+
+	m := make(Manifest)
+	if hashed := m.Add("css/style.css", "3f2a9c0123"); hashed != "/css/style.3f2a9c.css" {
+		test.Fatalf("Add returned '%s'", hashed)
+	}
+	m.Add("/page/img.png", "abcdef99")
+	if m.URL("css/style.css") != "/css/style.3f2a9c.css" || m.URL("/none.js") != "/none.js" {
+		test.Fatalf("invalid URL results: %v", m)
+	}
+
+	html := `<link href="/docs/css/style.css?v=1"><img src='/docs/page/img.png'><a href="/css/style.css">`
+	expect := `<link href="/docs/css/style.3f2a9c.css?v=1"><img src='/docs/page/img.abcdef.png'><a href="/css/style.css">`
+	if out := string(m.Rewrite([]byte(html), "/docs/", "", false)); out != expect {
+		test.Fatalf("Rewrite returned:\n%s\nshould be:\n%s", out, expect)
+	}
+	html = `<img src="img.png"><link href="../css/style.css#x"><a href="other.png"><a href="https://x.com/page/img.png">`
+	expect = `<img src="img.abcdef.png"><link href="../css/style.3f2a9c.css#x"><a href="other.png"><a href="https://x.com/page/img.png">`
+	if out := string(m.Rewrite([]byte(html), "/docs/", "page", false)); out != expect {
+		test.Fatalf("Rewrite returned for relative links:\n%s\nshould be:\n%s", out, expect)
+	}
+	css := `a { background: url("../page/img.png"); } b { background: url( /docs/page/img.png ) } c { background: url(data:image/png;base64,AA) }`
+	expect = `a { background: url("../page/img.abcdef.png"); } b { background: url( /docs/page/img.abcdef.png ) } c { background: url(data:image/png;base64,AA) }`
+	if out := string(m.Rewrite([]byte(css), "/docs/", "css", true)); out != expect {
+		test.Fatalf("Rewrite returned for css:\n%s\nshould be:\n%s", out, expect)
+	}
+
+	tdir := filepath.Join(os.TempDir(), "pagr_test", "TestManifest")
+	fpath := filepath.Join(tdir, "manifest.json")
+	if err := m.Write(fpath); err != nil {
+		test.Fatal(err)
+	}
+	var written Manifest
+	if buf, err := ioutil.ReadFile(fpath); err != nil {
+		test.Fatal(err)
+	} else if err = json.Unmarshal(buf, &written); err != nil {
+		test.Fatal(err)
+	} else if len(written) != 2 || written["/page/img.png"] != "/page/img.abcdef.png" {
+		test.Fatalf("invalid manifest written: %v", written)
+	}
+
+	if err := os.RemoveAll(tdir); err != nil {
+		test.Error(err)
+	}
+}
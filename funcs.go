@@ -0,0 +1,271 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	hmpl "html/template"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// templateFuncs is the function map available to "tmpl" and "hmpl" templates:
+//   - asset PATH: the (fingerprinted) URL of the asset at PATH, see `assetURL`
+//   - date LAYOUT TIME: TIME (a time.Time or date string) formatted with the Go
+//     time LAYOUT, e.g. `{{date "2 Jan 2006" .Updated}}`
+//   - absURL PATH: PATH as an absolute URL, prefixed with `Config.BaseURL`
+//   - relURL PATH: PATH prefixed with `Config.BasePath`
+//   - markdownify TEXT: TEXT converted from markdown to HTML
+//   - truncate LENGTH TEXT: TEXT cut to LENGTH characters at a word boundary
+//   - slugify TEXT: TEXT as a URL-friendly slug
+//   - where PAGES KEY VALUE: the PAGES where KEY equals VALUE
+//   - sortBy PAGES KEY ["desc"]: PAGES sorted by KEY
+//   - groupBy PAGES KEY: PAGES grouped by KEY (a list of `PageGroup`)
+//   - getPage PATH: the site page at PATH, or nil
+//   - readFile PATH: the contents of the file at PATH, relative to the
+//     project directory (the directory of the config file), which it can't
+//     be outside of
+//   - jsonify VALUE: VALUE encoded as JSON (the `Nav` of pages is omitted)
+//   - i18n KEY [LANG]: the translation of KEY in LANG (or `Config.Language`),
+//     see `Translations`
+//   - safeHTML, safeHTMLAttr, safeCSS, safeJS, safeURL TEXT: TEXT marked as
+//     safe for that context in "hmpl" templates, so it's not escaped
+//
+// For where/sortBy/groupBy, KEY is a `Page` field ("Path", "Slug", "Updated",
+// "Section" or "Kind") or a key in the page `Meta`.
+var templateFuncs = map[string]interface{}{
+	"asset":        assetURL,
+	"date":         formatDate,
+	"absURL":       absURL,
+	"relURL":       relURL,
+	"markdownify":  markdownify,
+	"truncate":     truncate,
+	"slugify":      slugify,
+	"where":        where,
+	"sortBy":       sortBy,
+	"groupBy":      groupBy,
+	"getPage":      getPage,
+	"readFile":     readFile,
+	"jsonify":      jsonify,
+	"i18n":         i18n,
+	"safeHTML":     func(s string) hmpl.HTML { return hmpl.HTML(s) },
+	"safeHTMLAttr": func(s string) hmpl.HTMLAttr { return hmpl.HTMLAttr(s) },
+	"safeCSS":      func(s string) hmpl.CSS { return hmpl.CSS(s) },
+	"safeJS":       func(s string) hmpl.JS { return hmpl.JS(s) },
+	"safeURL":      func(s string) hmpl.URL { return hmpl.URL(s) },
+}
+
+// sitePages are all the pages of the site being built, used by `getPage`.
+var sitePages []Page
+
+// dateLayouts are the layouts date strings are parsed with by `formatDate`.
+var dateLayouts = []string{timefmt, time.RFC3339, "2006-01-02 15:04:05", "2006-01-02T15:04:05", time.RFC1123Z}
+
+// formatDate returns `t` formatted with the time `layout`. `t` can be a
+// time.Time or a string in one of the `dateLayouts`.
+func formatDate(layout string, t interface{}) (string, error) {
+	switch v := t.(type) {
+	case time.Time:
+		return v.Format(layout), nil
+	case string:
+		for _, l := range dateLayouts {
+			if parsed, err := time.Parse(l, v); err == nil {
+				return parsed.Format(layout), nil
+			}
+		}
+		return "", fmt.Errorf("date: cannot parse '%s'", v)
+	}
+	return "", fmt.Errorf("date: invalid value type %T", t)
+}
+
+// relURL returns `path` prefixed with `config.BasePath`.
+func relURL(path string) string {
+	if strings.Contains(path, "://") {
+		return path
+	}
+	return joinURL(config.BasePath, path)
+}
+
+// absURL returns `path` as an absolute URL, using `config.BaseURL`. If no
+// BaseURL is set, the result of `relURL` is returned.
+func absURL(path string) string {
+	if strings.Contains(path, "://") {
+		return path
+	}
+	return strings.TrimSuffix(config.BaseURL, "/") + relURL(path)
+}
+
+func markdownify(s string) (hmpl.HTML, error) {
+	html, err := convertMarkdownToHTML([]byte(s))
+	return hmpl.HTML(html), err
+}
+
+// truncate returns `s` cut to at most `length` characters, at the last word
+// boundary before `length`, with "…" appended if it was cut. An error is
+// returned if `length` is negative.
+func truncate(length int, s string) (string, error) {
+	if length < 0 {
+		return "", fmt.Errorf("invalid truncate length %d", length)
+	}
+	runes := []rune(s)
+	if len(runes) <= length {
+		return s, nil
+	}
+	cut := length
+	for cut > 0 && !unicode.IsSpace(runes[cut]) {
+		cut--
+	}
+	if cut == 0 {
+		cut = length
+	}
+	return strings.TrimRightFunc(string(runes[:cut]), unicode.IsSpace) + "…", nil
+}
+
+// toPages returns `v` (a []Page or []*Page) as a []*Page.
+func toPages(v interface{}) ([]*Page, error) {
+	switch pages := v.(type) {
+	case []*Page:
+		return pages, nil
+	case []Page:
+		ptrs := make([]*Page, len(pages))
+		for i := range pages {
+			ptrs[i] = &pages[i]
+		}
+		return ptrs, nil
+	}
+	return nil, fmt.Errorf("invalid pages type %T", v)
+}
+
+// pageValue returns the value of `key` for `p`, see `templateFuncs`.
+func pageValue(p *Page, key string) interface{} {
+	switch key {
+	case "Path":
+		return p.Path
+	case "Slug":
+		return p.Slug
+	case "Updated":
+		return p.Updated
+	case "Section":
+		return p.Section()
+	case "Kind":
+		return p.Kind()
+	}
+	return p.Meta[key]
+}
+
+func where(pages interface{}, key string, value interface{}) ([]*Page, error) {
+	list, err := toPages(pages)
+	if err != nil {
+		return nil, err
+	}
+	matched := []*Page{}
+	for _, p := range list {
+		if v := pageValue(p, key); reflect.DeepEqual(v, value) || fmt.Sprint(v) == fmt.Sprint(value) {
+			matched = append(matched, p)
+		}
+	}
+	return matched, nil
+}
+
+// lessValue returns true if `a` sorts before `b`, numbers are compared as
+// numbers and anything else as strings.
+func lessValue(a, b interface{}) bool {
+	toFloat := func(v interface{}) (float64, bool) {
+		rv := reflect.ValueOf(v)
+		switch rv.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			return float64(rv.Int()), true
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			return float64(rv.Uint()), true
+		case reflect.Float32, reflect.Float64:
+			return rv.Float(), true
+		}
+		return 0, false
+	}
+	if af, ok := toFloat(a); ok {
+		if bf, ok := toFloat(b); ok {
+			return af < bf
+		}
+	}
+	return fmt.Sprint(a) < fmt.Sprint(b)
+}
+
+func sortBy(pages interface{}, key string, order ...string) ([]*Page, error) {
+	list, err := toPages(pages)
+	if err != nil {
+		return nil, err
+	}
+	sorted := append([]*Page{}, list...)
+	desc := len(order) > 0 && strings.ToLower(order[0]) == "desc"
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if desc {
+			return lessValue(pageValue(sorted[j], key), pageValue(sorted[i], key))
+		}
+		return lessValue(pageValue(sorted[i], key), pageValue(sorted[j], key))
+	})
+	return sorted, nil
+}
+
+// PageGroup is a group of pages with the same `Key` value, see `groupBy`.
+type PageGroup struct {
+	Key   string
+	Pages []*Page
+}
+
+func groupBy(pages interface{}, key string) ([]PageGroup, error) {
+	list, err := toPages(pages)
+	if err != nil {
+		return nil, err
+	}
+	var groups []PageGroup
+	index := make(map[string]int)
+	for _, p := range list {
+		var k string
+		if v := pageValue(p, key); v != nil {
+			k = fmt.Sprint(v)
+		}
+		if i, ok := index[k]; ok {
+			groups[i].Pages = append(groups[i].Pages, p)
+		} else {
+			index[k] = len(groups)
+			groups = append(groups, PageGroup{Key: k, Pages: []*Page{p}})
+		}
+	}
+	sort.SliceStable(groups, func(i, j int) bool { return groups[i].Key < groups[j].Key })
+	return groups, nil
+}
+
+func getPage(path string) *Page {
+	path = "/" + strings.Trim(path, "/")
+	for i, p := range sitePages {
+		if "/"+strings.Trim(p.Path, "/") == path {
+			return &sitePages[i]
+		}
+	}
+	return nil
+}
+
+func readFile(path string) (string, error) {
+	root, err := filepath.Abs(config.dir)
+	if err != nil {
+		return "", err
+	}
+	fpath := filepath.Clean(path)
+	if !filepath.IsAbs(fpath) {
+		fpath = filepath.Join(root, fpath)
+	}
+	if rel, err := filepath.Rel(root, fpath); err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("readFile: %s is outside of the project directory", path)
+	}
+	buf, err := ioutil.ReadFile(fpath)
+	return string(buf), err
+}
+
+func jsonify(v interface{}) (string, error) {
+	buf, err := json.Marshal(v)
+	return string(buf), err
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"bytes"
+	hmpl "html/template"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTemplateFuncs(test *testing.T) {
+	test.Parallel()
+
+	pages := []Page{NewPage("/b", time.Now()), NewPage("/a/x", time.Now()), NewPage("/a/y", time.Now())}
+	pages[0].Meta["weight"] = 2
+	pages[0].Meta["tag"] = "go"
+	pages[1].Meta["weight"] = 10
+	pages[1].Meta["tag"] = "go"
+	pages[2].Meta["weight"] = 1
+	pages[2].Meta["tag"] = "web"
+
+	for src, expect := range map[string]string{
+		`{{date "2 Jan 2006" "2021-03-04"}}`:                                               "4 Mar 2021",
+		`{{relURL "/css/a.css"}}`:                                                          "/css/a.css",
+		`{{markdownify "**b**"}}`:                                                          "<p><strong>b</strong></p>\n",
+		`{{truncate 10 "hello there world"}}`:                                              "hello…",
+		`{{slugify "Hello, World!"}}`:                                                      "hello-world",
+		`{{range where . "tag" "go"}}{{.Path}} {{end}}`:                                    "/b /a/x ",
+		`{{range sortBy . "weight"}}{{.Path}} {{end}}`:                                     "/a/y /b /a/x ",
+		`{{range sortBy . "Path" "desc"}}{{.Path}} {{end}}`:                                "/b /a/y /a/x ",
+		`{{range groupBy . "Section"}}{{.Key}}={{len .Pages}} {{end}}`:                     "a=2 b=1 ",
+		`{{jsonify (index . 0).Meta | safeHTML}}`:                                          `{"Title":"B","tag":"go","weight":2}`,
+		`{{"<b>" | safeHTML}} {{"<b>"}}`:                                                   "<b> &lt;b&gt;",
+		`<a href="{{"javascript:void(0)" | safeURL}}" style="{{"color: red" | safeCSS}}">`: `<a href="javascript:void%280%29" style="color: red">`,
+	} {
+		t, err := hmpl.New("test").Funcs(templateFuncs).Parse(src)
+		if err != nil {
+			test.Errorf("failed to parse '%s': %s", src, err)
+			continue
+		}
+		var buf bytes.Buffer
+		if err = t.Execute(&buf, pages); err != nil {
+			test.Errorf("failed to execute '%s': %s", src, err)
+		} else if buf.String() != expect {
+			test.Errorf("'%s' returned '%s' (should be '%s')", src, buf.String(), expect)
+		}
+	}
+
+	if _, err := truncate(-1, "hello"); err == nil {
+		test.Error("truncate didn't fail for a negative length")
+	} else if s, err := truncate(0, "hello"); err != nil || s != "…" {
+		test.Errorf("truncate(0) returned '%s' (%v)", s, err)
+	}
+
+	pages = BuildSitemap(pages)
+	if _, err := jsonify(pages[0]); err != nil {
+		test.Errorf("jsonify failed for a page: %s", err)
+	}
+
+	// config.dir isn't set in tests, so the project directory is the working directory
+	if src, err := readFile("funcs_test.go"); err != nil || !strings.HasPrefix(src, "package main") {
+		test.Errorf("readFile failed: %v", err)
+	}
+	for _, path := range []string{"../funcs.go", "/etc/hosts", "a/../../x"} {
+		if _, err := readFile(path); err == nil {
+			test.Errorf("readFile didn't fail for '%s', outside of the project directory", path)
+		}
+	}
+}
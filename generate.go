@@ -0,0 +1,154 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"notabug.org/gearsix/suti"
+)
+
+// Generator describes a set of virtual pages, where a `Page` is generated
+// for each record found in the data file at `.Source`.
+type Generator struct {
+	// Source is the filepath of the data file to read records from, it can
+	// be a ".csv" file (the first row is used as field names) or any data
+	// file supported by suti containing a list of key/values.
+	Source string
+	// Path is the pattern used to build the `.Path` of each generated page.
+	// Any "{{field}}" in `Path` is replaced with the slugified value of
+	// `field` in the record (e.g. "/team/{{slug}}").
+	Path string
+	// Template is set as the "template" Meta value of each generated page,
+	// unless the record provides it's own.
+	Template string
+}
+
+var pathFieldRegexp = regexp.MustCompile(`{{\s*([^{}\s]+)\s*}}`)
+
+// slugify returns `s` in lowercase, with any runs of characters that are not
+// letters or digits replaced with a single '-'.
+func slugify(s string) string {
+	var slug strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(strings.TrimSpace(s)) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') || r > 127 {
+			if dash && slug.Len() > 0 {
+				slug.WriteRune('-')
+			}
+			slug.WriteRune(r)
+			dash = false
+		} else {
+			dash = true
+		}
+	}
+	return slug.String()
+}
+
+func loadCsvRecords(fpath string) (records []Meta, err error) {
+	var f *os.File
+	if f, err = os.Open(fpath); err != nil {
+		return
+	}
+	defer f.Close()
+
+	var rows [][]string
+	if rows, err = csv.NewReader(f).ReadAll(); err != nil || len(rows) == 0 {
+		return
+	}
+
+	for _, row := range rows[1:] {
+		m := make(Meta)
+		for i, field := range rows[0] {
+			if i < len(row) {
+				m[field] = row[i]
+			}
+		}
+		records = append(records, m)
+	}
+	return
+}
+
+// LoadDataRecords reads the list of records in the data file at `fpath`.
+// ".csv" files are parsed with the first row as field names, any other
+// file is loaded with `suti.LoadDataFilepath`.
+func LoadDataRecords(fpath string) (records []Meta, err error) {
+	if filepath.Ext(fpath) == ".csv" {
+		records, err = loadCsvRecords(fpath)
+	} else if suti.IsSupportedDataLang(filepath.Ext(fpath)) != -1 {
+		err = suti.LoadDataFilepath(fpath, &records)
+	} else {
+		err = fmt.Errorf("unsupported data file type (%s)", filepath.Ext(fpath))
+	}
+	return
+}
+
+// recordPath returns `pattern` with each "{{field}}" replaced by the
+// slugified value of `field` in `record`. An error is returned if the
+// resulting path is empty (e.g. `pattern` is empty, or all it's fields are).
+func recordPath(pattern string, record Meta) (path string, err error) {
+	path = pathFieldRegexp.ReplaceAllStringFunc(pattern, func(match string) string {
+		field := pathFieldRegexp.FindStringSubmatch(match)[1]
+		v, ok := record[field]
+		if !ok && err == nil {
+			err = fmt.Errorf("record has no '%s' field", field)
+		}
+		return slugify(fmt.Sprint(v))
+	})
+	path = strings.Trim(filepath.ToSlash(filepath.Clean(path)), "/")
+	if err == nil && (len(path) == 0 || path == ".") {
+		err = fmt.Errorf("empty page path from the pattern '%s'", pattern)
+	}
+	path = "/" + path
+	return
+}
+
+// Generate returns a new `Page` for each record in `g.Source`. The `.Path`
+// of each page is built from `g.Path` and the record fields are merged into
+// it's `.Meta`.
+func (g Generator) Generate() (pages []Page, err error) {
+	var records []Meta
+	if records, err = LoadDataRecords(g.Source); err != nil {
+		return
+	}
+
+	updated := lastPageMod(g.Source)
+	for i, record := range records {
+		var path string
+		if path, err = recordPath(g.Path, record); err != nil {
+			err = fmt.Errorf("%s record %d: %s", g.Source, i, err)
+			return
+		}
+
+		p := NewPage(path, updated)
+		p.Meta.MergeMeta(record, true)
+		p.sources = []string{g.Source}
+		if _, ok := p.Meta["Template"]; !ok && len(g.Template) > 0 {
+			p.Meta.MergeMeta(Meta{"template": g.Template}, false)
+		}
+		pages = append(pages, p)
+	}
+	return
+}
+
+// LoadGeneratedPages calls `Generate` on each of `generators` and returns
+// all of the resulting pages, with the default Meta of `themes` applied
+// (see `ApplyThemeMeta`). Drafts are skipped, like content pages.
+func LoadGeneratedPages(generators []Generator, themes ...Theme) (p []Page, err error) {
+	for _, g := range generators {
+		var pages []Page
+		if pages, err = g.Generate(); err != nil {
+			break
+		}
+		for _, page := range pages {
+			page.applyThemeMeta(themes)
+			if !page.skipDraft() {
+				p = append(p, page)
+			}
+		}
+	}
+	return
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSlugify(test *testing.T) {
+	test.Parallel()
+
+	tests := map[string]string{
+		"Hello World":      "hello-world",
+		"  --foo__bar--  ": "foo-bar",
+		"A/B & C":          "a-b-c",
+	}
+	for in, out := range tests {
+		if slug := slugify(in); slug != out {
+			test.Errorf("slugify('%s') returned '%s' (should be '%s')", in, slug, out)
+		}
+	}
+}
+
+func TestLoadGeneratedPages(test *testing.T) {
+	test.Parallel()
+
+	tdir := filepath.Join(os.TempDir(), "pagr_test", "TestLoadGeneratedPages")
+	if err := os.MkdirAll(tdir, 0775); err != nil {
+		test.Errorf("failed to create temporary test dir: %s", tdir)
+	}
+
+	data := map[string]string{
+		"team.csv":      "name,role\nJane Doe,admin\nJohn Smith,dev\n",
+		"products.json": `[{"slug": "Widget One", "price": 1}, {"slug": "widget-two", "template": "custom"}, {"slug": "next", "Draft": true}]`,
+		"empty.json":    `[{"name": ""}]`,
+	}
+	for fname, d := range data {
+		if err := ioutil.WriteFile(filepath.Join(tdir, fname), []byte(d), 0644); err != nil {
+			test.Error("setup failed:", err)
+		}
+	}
+
+	generators := []Generator{
+		{Source: filepath.Join(tdir, "team.csv"), Path: "/team/{{name}}"},
+		{Source: filepath.Join(tdir, "products.json"), Path: "/products/{{ slug }}", Template: "product"},
+	}
+	pages, err := LoadGeneratedPages(generators)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	expect := map[string]string{ // [path]template
+		"/team/jane-doe":       "default",
+		"/team/john-smith":     "default",
+		"/products/widget-one": "product",
+		"/products/widget-two": "custom",
+	}
+	if len(pages) != len(expect) {
+		test.Fatalf("%d pages generated (should be %d)", len(pages), len(expect))
+	}
+	for _, p := range pages {
+		if tmpl, ok := expect[p.Path]; !ok {
+			test.Errorf("unexpected page generated: '%s'", p.Path)
+		} else if p.TemplateName("default") != tmpl {
+			test.Errorf("'%s' has template '%s' (should be '%s')",
+				p.Path, p.TemplateName("default"), tmpl)
+		}
+	}
+	if pages[0].Meta["role"] != "admin" {
+		test.Errorf("record fields missing from Meta: %v", pages[0].Meta)
+	}
+
+	generators = append(generators, Generator{Source: generators[0].Source, Path: "/{{missing}}"})
+	if _, err = LoadGeneratedPages(generators); err == nil {
+		test.Error("no error returned for missing path field")
+	}
+	for _, pattern := range []string{"", "/{{name}}/"} {
+		g := Generator{Source: filepath.Join(tdir, "empty.json"), Path: pattern}
+		if _, err = g.Generate(); err == nil || !strings.Contains(err.Error(), "empty page path") {
+			test.Errorf("no error returned for the empty path from '%s': %v", pattern, err)
+		}
+	}
+
+	if err = os.RemoveAll(tdir); err != nil {
+		test.Error(err)
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bytes"
+	hmpl "html/template"
+
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/renderer"
+	goldmarkhtml "github.com/yuin/goldmark/renderer/html"
+	"github.com/yuin/goldmark/util"
+	"notabug.org/gearsix/suti"
+)
+
+// hooksDir is the subdirectory of the templates directory that markdown
+// render hook templates are loaded from. Hooks are named by the markdown
+// node they render: "link", "image", "heading" or "codeblock".
+const hooksDir = "hooks"
+
+// renderHooks are the render hook templates used when converting markdown
+// content files, see `LoadRenderHookDir`.
+var renderHooks map[string]suti.Template
+
+// RenderHook is the data a render hook template is executed with.
+type RenderHook struct {
+	Page        *Page
+	Destination string    // link & image URL
+	Title       string    // link & image title
+	Text        hmpl.HTML // rendered content of the link, image alt or heading
+	PlainText   string    // `Text` without any markup
+	Level       int       // heading level
+	ID          string    // heading id
+	Language    string    // code block language
+	Code        string    // code block content
+}
+
+// LoadRenderHookDir loads every template file in `dirs` as a render hook,
+// named by it's filename (without extension), see `LoadShortcodeDir`.
+func LoadRenderHookDir(dirs ...string) (map[string]suti.Template, error) {
+	return loadNamedTemplates("render hook", dirs...)
+}
+
+// hookRenderer is a goldmark NodeRenderer that renders nodes with the
+// template in `hooks` matching the node type, for the page `page`.
+type hookRenderer struct {
+	hooks map[string]suti.Template
+	page  *Page
+	inner renderer.Renderer // used to render the children of nodes
+}
+
+func newHookRenderer(hooks map[string]suti.Template, p *Page) *hookRenderer {
+	h := &hookRenderer{hooks: hooks, page: p}
+	h.inner = renderer.NewRenderer(renderer.WithNodeRenderers(
+		util.Prioritized(goldmarkhtml.NewRenderer(goldmarkhtml.WithUnsafe()), 1000),
+		util.Prioritized(h, 100)))
+	return h
+}
+
+// RegisterFuncs registers a render function for each node type that has
+// a hook template, other nodes are rendered as usual.
+func (h *hookRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	kinds := map[string][]ast.NodeKind{
+		"link":      {ast.KindLink},
+		"image":     {ast.KindImage},
+		"heading":   {ast.KindHeading},
+		"codeblock": {ast.KindFencedCodeBlock, ast.KindCodeBlock},
+	}
+	for name, nodeKinds := range kinds {
+		if _, ok := h.hooks[name]; !ok {
+			continue
+		}
+		for _, kind := range nodeKinds {
+			reg.Register(kind, h.render(name))
+		}
+	}
+}
+
+// children returns the rendered HTML of the children of `n`.
+func (h *hookRenderer) children(source []byte, n ast.Node) (hmpl.HTML, error) {
+	var buf bytes.Buffer
+	for c := n.FirstChild(); c != nil; c = c.NextSibling() {
+		if err := h.inner.Render(&buf, source, c); err != nil {
+			return "", err
+		}
+	}
+	return hmpl.HTML(buf.String()), nil
+}
+
+// codeLines returns the raw content of the code block `n`.
+func codeLines(source []byte, n ast.Node) string {
+	var code bytes.Buffer
+	for i := 0; i < n.Lines().Len(); i++ {
+		line := n.Lines().At(i)
+		code.Write(line.Value(source))
+	}
+	return code.String()
+}
+
+func (h *hookRenderer) render(name string) renderer.NodeRendererFunc {
+	return func(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+
+		data := RenderHook{Page: h.page, PlainText: string(node.Text(source))}
+		var err error
+		switch n := node.(type) {
+		case *ast.Link:
+			data.Destination, data.Title = string(n.Destination), string(n.Title)
+			data.Text, err = h.children(source, n)
+		case *ast.Image:
+			data.Destination, data.Title = string(n.Destination), string(n.Title)
+			data.Text = hmpl.HTML(hmpl.HTMLEscapeString(data.PlainText))
+		case *ast.Heading:
+			data.Level = n.Level
+			if id, ok := n.AttributeString("id"); ok {
+				if b, ok := id.([]byte); ok {
+					data.ID = string(b)
+				}
+			}
+			data.Text, err = h.children(source, n)
+		case *ast.FencedCodeBlock:
+			data.Language = string(n.Language(source))
+			data.Code = codeLines(source, n)
+		case *ast.CodeBlock:
+			data.Code = codeLines(source, n)
+		}
+		if err != nil {
+			return ast.WalkStop, err
+		}
+
+		tmpl := h.hooks[name]
+		buf, err := tmpl.Execute(data)
+		if err != nil {
+			return ast.WalkStop, err
+		}
+		_, err = w.Write(buf.Bytes())
+		return ast.WalkSkipChildren, err
+	}
+}
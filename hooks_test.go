@@ -0,0 +1,58 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/util"
+)
+
+func TestRenderHooks(test *testing.T) {
+	test.Parallel()
+
+	tdir := filepath.Join(os.TempDir(), "pagr_test", "TestRenderHooks")
+	files := map[string]string{
+		"link.hmpl":      `<a href="{{.Destination}}" title="{{.Title}}" data-page="{{.Page.Path}}">{{.Text}}</a>`,
+		"image.hmpl":     `<img src="{{.Destination}}" alt="{{.PlainText}}">`,
+		"heading.hmpl":   `<h{{.Level}} id="{{.ID}}"><a href="#{{.ID}}">{{.Text}}</a></h{{.Level}}>`,
+		"codeblock.tmpl": `<pre data-lang="{{.Language}}">{{.Code}}</pre>`,
+	}
+	if err := os.MkdirAll(tdir, 0775); err != nil {
+		test.Fatal("setup failed:", err)
+	}
+	for fname, data := range files {
+		if err := ioutil.WriteFile(filepath.Join(tdir, fname), []byte(data), 0644); err != nil {
+			test.Fatal("setup failed:", err)
+		}
+	}
+
+	hooks, err := LoadRenderHookDir(tdir)
+	if err != nil {
+		test.Fatal(err)
+	} else if len(hooks) != 4 {
+		test.Fatalf("LoadRenderHookDir loaded %d hooks (should be 4)", len(hooks))
+	}
+
+	p := NewPage("/test", time.Now())
+	md := "# A *title*\n\n[**link**](/x \"X\") ![alt](a.png)\n\n```go\nfmt.Println()\n```\n"
+	html, err := convertMarkdownToHTML([]byte(md), goldmark.WithRendererOptions(
+		renderer.WithNodeRenderers(util.Prioritized(newHookRenderer(hooks, &p), 100))))
+	if err != nil {
+		test.Fatal(err)
+	}
+	expect := "<h1 id=\"a-title\"><a href=\"#a-title\">A <em>title</em></a></h1>" +
+		"<p><a href=\"/x\" title=\"X\" data-page=\"/test\"><strong>link</strong></a> <img src=\"a.png\" alt=\"alt\"></p>\n" +
+		"<pre data-lang=\"go\">fmt.Println()\n</pre>"
+	if html != expect {
+		test.Errorf("invalid render hook output:\n%s\nshould be:\n%s", html, expect)
+	}
+
+	if err = os.RemoveAll(tdir); err != nil {
+		test.Error(err)
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"notabug.org/gearsix/suti"
+)
+
+// Translations maps language codes (e.g. "en") to the translated text of
+// each key in that language.
+type Translations map[string]map[string]string
+
+// translations are the Translations used by the "i18n" template function.
+var translations Translations
+
+// LoadI18nDir loads each data file in `dirs` as the translations for the
+// language it's named by (e.g. "en.yaml"), a map of keys to text.
+// Translations in later `dirs` override those with the same key in earlier
+// `dirs`. Any `dirs` that don't exist are skipped.
+func LoadI18nDir(dirs ...string) (t Translations, err error) {
+	t = make(Translations)
+	for _, dir := range existingDirs(dirs) {
+		err = filepath.Walk(dir, func(path string, info os.FileInfo, e error) error {
+			if e != nil || info.IsDir() || ignoreFile(path) || suti.IsSupportedDataLang(filepath.Ext(path)) == -1 {
+				return e
+			}
+			var data map[string]interface{}
+			if e = suti.LoadDataFilepath(path, &data); e != nil {
+				return dataError(path, e)
+			}
+			lang := strings.ToLower(templateName(path))
+			if _, ok := t[lang]; !ok {
+				t[lang] = make(map[string]string)
+			}
+			for k, v := range data {
+				t[lang][k] = fmt.Sprint(v)
+			}
+			return nil
+		})
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// Translate returns the text of `key` in the language `lang`. If there's
+// no translation for `key`, then `key` is returned.
+func (t Translations) Translate(lang, key string) string {
+	if text, ok := t[strings.ToLower(lang)][key]; ok {
+		return text
+	}
+	return key
+}
+
+// i18n returns the `translations` text of `key`, in the language `lang`
+// (if it's set) or `config.Language`.
+func i18n(key string, lang ...string) string {
+	l := config.Language
+	if len(lang) > 0 && len(lang[0]) > 0 {
+		l = lang[0]
+	}
+	return translations.Translate(l, key)
+}
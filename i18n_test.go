@@ -0,0 +1,49 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadI18nDir(test *testing.T) {
+	test.Parallel()
+
+	tdir := filepath.Join(os.TempDir(), "pagr_test", "TestLoadI18nDir")
+	files := map[string]string{
+		"theme/en.json": `{"readMore": "Read more", "next": "Next"}`,
+		"theme/fr.json": `{"readMore": "Lire la suite"}`,
+		"own/EN.json":   `{"next": "Next page", "count": 3}`,
+	}
+	for fname, data := range files {
+		fpath := filepath.Join(tdir, fname)
+		if err := os.MkdirAll(filepath.Dir(fpath), 0775); err != nil {
+			test.Fatal("setup failed:", err)
+		}
+		if err := ioutil.WriteFile(fpath, []byte(data), 0644); err != nil {
+			test.Fatal("setup failed:", err)
+		}
+	}
+
+	t, err := LoadI18nDir(filepath.Join(tdir, "theme"), filepath.Join(tdir, "own"), filepath.Join(tdir, "missing"))
+	if err != nil {
+		test.Fatal(err)
+	}
+	for _, tc := range []struct{ lang, key, expect string }{
+		{"en", "readMore", "Read more"},
+		{"en", "next", "Next page"},
+		{"en", "count", "3"},
+		{"FR", "readMore", "Lire la suite"},
+		{"fr", "next", "next"},
+		{"de", "readMore", "readMore"},
+	} {
+		if text := t.Translate(tc.lang, tc.key); text != tc.expect {
+			test.Errorf("Translate(%s, %s) returned '%s' (should be '%s')", tc.lang, tc.key, text, tc.expect)
+		}
+	}
+
+	if err = os.RemoveAll(tdir); err != nil {
+		test.Error(err)
+	}
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// ImageConfig is the data structure containing all key/values that control
+// how images found in content directories are processed during a build.
+type ImageConfig struct {
+	// Widths is a list of widths (in pixels) to generate resized variants
+	// of each image at. Widths larger than the original image are skipped.
+	Widths []int
+	// Thumbnail is the width (in pixels) of the thumbnail generated for
+	// each image, 0 disables thumbnails.
+	Thumbnail int
+	// Quality is the JPEG quality (1-100) images are encoded with.
+	Quality int
+	// Reencode sets whether original images are re-encoded instead of
+	// copied, which strips any EXIF (and other) metadata from them.
+	Reencode bool
+}
+
+// ImageVariant is a resized copy of an image `Asset`.
+type ImageVariant struct {
+	URL    string
+	Width  int
+	Height int
+}
+
+func isProcessableImage(fpath string) bool {
+	switch strings.ToLower(filepath.Ext(fpath)) {
+	case ".jpg", ".jpeg", ".png":
+		return true
+	}
+	return false
+}
+
+// variantName returns the filename `fname` with `suffix` inserted before
+// it's extension.
+func variantName(fname, suffix string) string {
+	ext := filepath.Ext(fname)
+	return strings.TrimSuffix(fname, ext) + "-" + suffix + ext
+}
+
+// resizeImage scales `src` to `width` pixels wide (keeping the aspect ratio)
+// by averaging the area of source pixels covered by each output pixel.
+func resizeImage(src image.Image, width int) *image.RGBA {
+	b := src.Bounds()
+	height := b.Dy() * width / b.Dx()
+	if height < 1 {
+		height = 1
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+
+	xscale := float64(b.Dx()) / float64(width)
+	yscale := float64(b.Dy()) / float64(height)
+	for y := 0; y < height; y++ {
+		y0 := b.Min.Y + int(float64(y)*yscale)
+		y1 := b.Min.Y + int(float64(y+1)*yscale)
+		if y1 <= y0 {
+			y1 = y0 + 1
+		}
+		for x := 0; x < width; x++ {
+			x0 := b.Min.X + int(float64(x)*xscale)
+			x1 := b.Min.X + int(float64(x+1)*xscale)
+			if x1 <= x0 {
+				x1 = x0 + 1
+			}
+
+			var r, g, bl, a, n uint64
+			for sy := y0; sy < y1 && sy < b.Max.Y; sy++ {
+				for sx := x0; sx < x1 && sx < b.Max.X; sx++ {
+					cr, cg, cb, ca := src.At(sx, sy).RGBA()
+					r, g, bl, a = r+uint64(cr), g+uint64(cg), bl+uint64(cb), a+uint64(ca)
+					n++
+				}
+			}
+			dst.SetRGBA(x, y, color.RGBA{
+				R: uint8(r / n >> 8), G: uint8(g / n >> 8),
+				B: uint8(bl / n >> 8), A: uint8(a / n >> 8),
+			})
+		}
+	}
+	return dst
+}
+
+func (cfg ImageConfig) encode(img image.Image, dst string) (err error) {
+	if err = os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return
+	}
+
+	// encoded to a buffer, since `dst` may be a hard link (see `replaceFile`)
+	var buf bytes.Buffer
+	switch strings.ToLower(filepath.Ext(dst)) {
+	case ".jpg", ".jpeg":
+		quality := cfg.Quality
+		if quality <= 0 || quality > 100 {
+			quality = jpeg.DefaultQuality
+		}
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality})
+	case ".png":
+		err = (&png.Encoder{CompressionLevel: png.BestCompression}).Encode(&buf, img)
+	default:
+		err = fmt.Errorf("cannot encode image type %s", filepath.Ext(dst))
+	}
+	if err == nil {
+		err = replaceFile(dst, buf.Bytes(), 0644)
+	}
+	return
+}
+
+// upToDate returns true if the file at `dst` exists and was modified after `src`.
+func upToDate(src os.FileInfo, dst string) bool {
+	info, err := os.Stat(dst)
+	return err == nil && info.ModTime().After(src.ModTime())
+}
+
+// Process writes the image asset `img` to `outDir` along with any resized
+// variants and thumbnail set in `cfg`, then sets the `.Variants` and
+// `.Thumbnail` of `img`. Images that can't be decoded are copied with `CopyFile`.
+// Output files that are newer than `img.Path` aren't re-generated.
+func (cfg ImageConfig) Process(img *Asset, outDir string) (err error) {
+	src := img.Path
+	dst := filepath.Join(outDir, filepath.FromSlash(img.URL))
+	if !isProcessableImage(src) || img.Width == 0 ||
+		(!cfg.Reencode && len(cfg.Widths) == 0 && cfg.Thumbnail <= 0) {
+		return CopyFile(src, dst)
+	}
+
+	var srcfi os.FileInfo
+	if srcfi, err = os.Stat(src); err != nil {
+		return
+	}
+
+	var decoded image.Image
+	decode := func() (image.Image, error) {
+		if decoded != nil {
+			return decoded, nil
+		}
+		f, err := os.Open(src)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		decoded, _, err = image.Decode(f)
+		return decoded, err
+	}
+	write := func(dst string, width int) (err error) {
+		if upToDate(srcfi, dst) {
+			return
+		}
+		var d image.Image
+		if d, err = decode(); err == nil {
+			if width > 0 {
+				d = resizeImage(d, width)
+			}
+			err = cfg.encode(d, dst)
+		}
+		return
+	}
+
+	if cfg.Reencode {
+		err = write(dst, 0)
+	} else {
+		err = CopyFile(src, dst)
+	}
+	if err != nil {
+		return
+	}
+
+	img.Variants = nil
+	for _, w := range cfg.Widths {
+		if w <= 0 || w >= img.Width {
+			continue
+		}
+		fname := variantName(filepath.Base(dst), fmt.Sprintf("%dw", w))
+		if err = write(filepath.Join(filepath.Dir(dst), fname), w); err != nil {
+			return
+		}
+		img.Variants = append(img.Variants, ImageVariant{
+			URL:    path.Join(path.Dir(img.URL), fname),
+			Width:  w,
+			Height: img.Height * w / img.Width,
+		})
+	}
+
+	if cfg.Thumbnail > 0 {
+		w := cfg.Thumbnail
+		if w > img.Width {
+			w = img.Width
+		}
+		fname := variantName(filepath.Base(dst), "thumb")
+		if err = write(filepath.Join(filepath.Dir(dst), fname), w); err == nil {
+			img.Thumbnail = path.Join(path.Dir(img.URL), fname)
+		}
+	}
+	return
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestImageProcess(test *testing.T) {
+	test.Parallel()
+
+	tdir := filepath.Join(os.TempDir(), "pagr_test", "TestImageProcess")
+	if err := os.MkdirAll(filepath.Join(tdir, "src"), 0775); err != nil {
+		test.Errorf("failed to create temporary test dir: %s", tdir)
+	}
+
+	src := image.NewRGBA(image.Rect(0, 0, 100, 50))
+	for x := 0; x < 100; x++ {
+		for y := 0; y < 50; y++ {
+			src.Set(x, y, color.RGBA{uint8(x), uint8(y), 0, 255})
+		}
+	}
+	writeImage := func(fname string) string {
+		fpath := filepath.Join(tdir, "src", fname)
+		f, err := os.Create(fpath)
+		if err != nil {
+			test.Fatal("setup failed:", err)
+		}
+		if filepath.Ext(fname) == ".png" {
+			err = png.Encode(f, src)
+		} else {
+			err = jpeg.Encode(f, src, nil)
+		}
+		if err != nil {
+			test.Fatal("setup failed:", err)
+		}
+		f.Close()
+		return fpath
+	}
+
+	cfg := ImageConfig{Widths: []int{40, 200}, Thumbnail: 20, Quality: 50, Reencode: true}
+	outDir := filepath.Join(tdir, "out")
+	for _, fname := range []string{"a.png", "b.jpg"} {
+		fpath := writeImage(fname)
+		img, err := NewAsset(fpath, "/page/"+fname)
+		if err != nil {
+			test.Fatal(err)
+		} else if img.Width != 100 || img.Height != 50 {
+			test.Fatalf("invalid dimensions for %s: %dx%d", fname, img.Width, img.Height)
+		}
+
+		if err := cfg.Process(&img, outDir); err != nil {
+			test.Fatal(err)
+		}
+		if len(img.Variants) != 1 || img.Variants[0].Width != 40 || img.Variants[0].Height != 20 {
+			test.Fatalf("invalid Variants for %s: %v", fname, img.Variants)
+		}
+		if img.Srcset() != img.Variants[0].URL+" 40w, /page/"+fname+" 100w" {
+			test.Errorf("invalid Srcset for %s: '%s'", fname, img.Srcset())
+		}
+
+		for _, out := range []string{img.URL, img.Variants[0].URL, img.Thumbnail} {
+			f, err := os.Open(filepath.Join(outDir, out))
+			if err != nil {
+				test.Fatal(err)
+			}
+			c, _, err := image.DecodeConfig(f)
+			f.Close()
+			if err != nil {
+				test.Fatal(err)
+			}
+			if out == img.Thumbnail && c.Width != 20 {
+				test.Errorf("thumbnail %s has width %d (should be 20)", out, c.Width)
+			}
+		}
+	}
+
+	if err := os.RemoveAll(tdir); err != nil {
+		test.Error(err)
+	}
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// LinkError is a broken link found in an output file.
+type LinkError struct {
+	File    string   // output file the link was found in
+	Sources []string // source files of the page the output file was built from
+	Link    string   // value of the href/src attribute
+	Reason  string
+}
+
+func (e LinkError) Error() string {
+	src := e.File
+	if len(e.Sources) > 0 {
+		src = strings.Join(e.Sources, ", ")
+	}
+	return fmt.Sprintf("%s: broken link '%s' (%s)", src, e.Link, e.Reason)
+}
+
+// LinkChecker checks the internal (and optionally external) links of all
+// HTML files in `.Root`.
+type LinkChecker struct {
+	// Root is the directory containing the output files to check.
+	Root string
+	// Base is the base path that absolute links to files in `Root` have.
+	Base string
+	// Sources maps output filepaths to the source files they were built from.
+	Sources map[string][]string
+	// External sets whether links to other hosts are checked, if false
+	// they're skipped.
+	External bool
+	// Client is used to request external links, if nil a client with a
+	// 10 second timeout is used.
+	Client *http.Client
+
+	ids      map[string]map[string]bool // [file][id]exists
+	external map[string]string          // [url]reason
+}
+
+var linkAttrRegexp = regexp.MustCompile(`(?i)\s(?:href|src)\s*=\s*(?:"([^"]*)"|'([^']*)'|([^\s"'>]+))`)
+var idAttrRegexp = regexp.MustCompile(`(?i)\s(?:id|name)\s*=\s*(?:"([^"]*)"|'([^']*)'|([^\s"'>]+))`)
+
+// matchAttrValues returns the values of the attributes matched by `r` in
+// `src`, with any HTML entities (e.g. "&amp;") unescaped.
+func matchAttrValues(r *regexp.Regexp, src string) (values []string) {
+	for _, m := range r.FindAllStringSubmatch(src, -1) {
+		values = append(values, html.UnescapeString(m[1]+m[2]+m[3]))
+	}
+	return
+}
+
+func isHTMLFile(fpath string) bool {
+	ext := strings.ToLower(filepath.Ext(fpath))
+	return ext == ".html" || ext == ".htm"
+}
+
+func skipLink(link string) bool {
+	for _, prefix := range []string{"mailto:", "tel:", "javascript:", "data:"} {
+		if strings.HasPrefix(strings.ToLower(link), prefix) {
+			return true
+		}
+	}
+	return len(strings.TrimSpace(link)) == 0
+}
+
+// fileIDs returns the id/name attribute values found in the HTML file at `fpath`.
+func (c *LinkChecker) fileIDs(fpath string) map[string]bool {
+	if c.ids == nil {
+		c.ids = make(map[string]map[string]bool)
+	}
+	if ids, ok := c.ids[fpath]; ok {
+		return ids
+	}
+
+	ids := make(map[string]bool)
+	if buf, err := ioutil.ReadFile(fpath); err == nil {
+		for _, id := range matchAttrValues(idAttrRegexp, string(buf)) {
+			ids[id] = true
+		}
+	}
+	c.ids[fpath] = ids
+	return ids
+}
+
+func (c *LinkChecker) checkExternal(link string) string {
+	if c.external == nil {
+		c.external = make(map[string]string)
+	}
+	if reason, ok := c.external[link]; ok {
+		return reason
+	}
+
+	client := c.Client
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+
+	var reason string
+	resp, err := client.Head(link)
+	if err == nil && resp.StatusCode == http.StatusMethodNotAllowed {
+		resp.Body.Close()
+		resp, err = client.Get(link)
+	}
+	if err != nil {
+		reason = err.Error()
+	} else {
+		if resp.StatusCode >= 400 {
+			reason = resp.Status
+		}
+		resp.Body.Close()
+	}
+	c.external[link] = reason
+	return reason
+}
+
+// checkInternal returns the reason `link` (found in the file at `fpath`)
+// is broken, or an empty string if it's not.
+func (c *LinkChecker) checkInternal(fpath string, link *url.URL) string {
+	target := fpath
+	if len(link.Path) > 0 {
+		if strings.HasPrefix(link.Path, "/") {
+			path := link.Path
+			if base := strings.TrimSuffix(c.Base, "/"); path == base || strings.HasPrefix(path, base+"/") {
+				path = "/" + strings.TrimPrefix(path, base)
+			}
+			target = filepath.Join(c.Root, filepath.FromSlash(path))
+		} else {
+			target = filepath.Join(filepath.Dir(fpath), filepath.FromSlash(link.Path))
+		}
+	}
+
+	info, err := os.Stat(target)
+	if err == nil && info.IsDir() {
+		target = filepath.Join(target, "index.html")
+		info, err = os.Stat(target)
+	}
+	if err != nil {
+		return "target not found"
+	}
+
+	if len(link.Fragment) > 0 && isHTMLFile(target) && !c.fileIDs(target)[link.Fragment] {
+		return fmt.Sprintf("no element with id '%s' in %s", link.Fragment,
+			strings.TrimPrefix(target, c.Root))
+	}
+	return ""
+}
+
+// CheckFile returns a `LinkError` for each broken link in the HTML file at `fpath`.
+func (c *LinkChecker) CheckFile(fpath string) (broken []LinkError, err error) {
+	var buf []byte
+	if buf, err = ioutil.ReadFile(fpath); err != nil {
+		return
+	}
+
+	for _, link := range matchAttrValues(linkAttrRegexp, string(buf)) {
+		if skipLink(link) {
+			continue
+		}
+
+		var reason string
+		if u, e := url.Parse(strings.TrimSpace(link)); e != nil {
+			reason = e.Error()
+		} else if u.IsAbs() || len(u.Host) > 0 {
+			if c.External && (u.Scheme == "http" || u.Scheme == "https") {
+				reason = c.checkExternal(u.String())
+			}
+		} else {
+			reason = c.checkInternal(fpath, u)
+		}
+
+		if len(reason) > 0 {
+			broken = append(broken, LinkError{
+				File:    fpath,
+				Sources: c.Sources[fpath],
+				Link:    link,
+				Reason:  reason,
+			})
+		}
+	}
+	return
+}
+
+// Check calls `CheckFile` on every HTML file found in `c.Root`.
+func (c *LinkChecker) Check() (broken []LinkError, err error) {
+	err = filepath.Walk(c.Root, func(fpath string, info os.FileInfo, e error) error {
+		if e != nil || info.IsDir() || !isHTMLFile(fpath) {
+			return e
+		}
+		b, e := c.CheckFile(fpath)
+		broken = append(broken, b...)
+		return e
+	})
+	return
+}
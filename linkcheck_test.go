@@ -0,0 +1,84 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestLinkChecker(test *testing.T) {
+	test.Parallel()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/ok" || strings.Contains(r.URL.RawQuery, "amp;") {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	tdir := filepath.Join(os.TempDir(), "pagr_test", "TestLinkChecker")
+	files := map[string]string{
+		"index.html": `<a href="/a/">a</a> <a href='a/#sec'>sec</a> <a href="/a/#missing">x</a>
+			<img src="/missing.png"> <a href="#top" id="top">top</a> <a href="mailto:x@y.z">m</a>
+			<a href="` + srv.URL + `/ok">ok</a> <a href="` + srv.URL + `/bad">bad</a>
+			<a href="` + srv.URL + `/ok?x=1&amp;y=2">query</a> <a href="a/#a&b">entity</a>`,
+		"a/index.html": `<h1 id="sec">Sec</h1><img src="../img.png"><a href="../b">b</a><p id="a&amp;b"></p>`,
+		"img.png":      "",
+	}
+	for fpath, data := range files {
+		fpath = filepath.Join(tdir, fpath)
+		if err := os.MkdirAll(filepath.Dir(fpath), 0775); err != nil {
+			test.Errorf("failed to create temporary test dir: %s", tdir)
+		}
+		if err := ioutil.WriteFile(fpath, []byte(data), 0644); err != nil {
+			test.Error("setup failed:", err)
+		}
+	}
+
+	index := filepath.Join(tdir, "index.html")
+	checker := LinkChecker{
+		Root:     tdir,
+		Sources:  map[string][]string{index: {"content/index.md"}},
+		External: true,
+	}
+	broken, err := checker.Check()
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	var links []string
+	for _, b := range broken {
+		links = append(links, b.Link)
+		if b.File == index && (len(b.Sources) != 1 || b.Sources[0] != "content/index.md") {
+			test.Errorf("invalid Sources for '%s': %v", b.Link, b.Sources)
+		}
+	}
+	sort.Strings(links)
+	expect := []string{"../b", "/a/#missing", "/missing.png", srv.URL + "/bad"}
+	sort.Strings(expect)
+	if len(links) != len(expect) {
+		test.Fatalf("found broken links %v (should be %v)", links, expect)
+	}
+	for i := range expect {
+		if links[i] != expect[i] {
+			test.Fatalf("found broken links %v (should be %v)", links, expect)
+		}
+	}
+
+	checker.External = false
+	checker.external = nil
+	if broken, err = checker.Check(); err != nil {
+		test.Fatal(err)
+	} else if len(broken) != len(expect)-1 {
+		test.Errorf("external links not skipped: %v", broken)
+	}
+
+	if err = os.RemoveAll(tdir); err != nil {
+		test.Error(err)
+	}
+}
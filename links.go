@@ -0,0 +1,113 @@
+package main
+
+import (
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/yuin/goldmark/ast"
+	goldmarkparse "github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/text"
+)
+
+// LinkResolver rewrites relative links in content files that point to other
+// content files, content directories or assets under `.Root` to the URL
+// they will have in the build output.
+type LinkResolver struct {
+	// Root is the contents directory that pages are loaded from.
+	Root string
+	// Base is the base path that output URLs are prefixed with (e.g.
+	// "/docs" if the site is served from "https://example.com/docs/").
+	Base string
+}
+
+// joinURL returns `path` prefixed with the base path `base`.
+func joinURL(base, path string) string {
+	base = strings.TrimSuffix(base, "/")
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	return base + path
+}
+
+// pageURL returns the output URL of the page generated for content directory `dir`.
+func (r *LinkResolver) pageURL(dir string) string {
+	path := pagePath(r.Root, dir)
+	if path != "/" {
+		path += "/"
+	}
+	return joinURL(r.Base, path)
+}
+
+// Resolve returns the output URL of `link`, found in the content file at
+// `fpath`. `ok` is false if `link` points to a file that doesn't exist.
+// Links that are absolute, fragment-only or don't point to a file under
+// `r.Root` are returned unchanged.
+func (r *LinkResolver) Resolve(fpath, link string) (resolved string, ok bool) {
+	resolved, ok = link, true
+
+	u, err := url.Parse(link)
+	if err != nil || u.IsAbs() || len(u.Host) > 0 || len(u.Path) == 0 ||
+		strings.HasPrefix(u.Path, "/") {
+		return
+	}
+
+	target := filepath.Join(filepath.Dir(fpath), filepath.FromSlash(u.Path))
+	if rel, err := filepath.Rel(r.Root, target); err != nil || strings.HasPrefix(rel, "..") {
+		return
+	}
+
+	var info os.FileInfo
+	if info, err = os.Stat(target); err != nil {
+		return link, false
+	}
+
+	if info.IsDir() {
+		resolved = r.pageURL(target)
+	} else if isContentExt(filepath.Ext(target)) != -1 {
+		resolved = r.pageURL(filepath.Dir(target))
+	} else {
+		resolved = r.pageURL(filepath.Dir(target)) + url.PathEscape(filepath.Base(target))
+	}
+
+	if len(u.RawQuery) > 0 {
+		resolved += "?" + u.RawQuery
+	}
+	if len(u.Fragment) > 0 {
+		resolved += "#" + u.Fragment
+	}
+	return
+}
+
+// linkTransformer is a goldmark AST transformer that resolves the
+// destination of all link & image nodes in the content file at `fpath`.
+type linkTransformer struct {
+	resolver *LinkResolver
+	fpath    string
+}
+
+func (t linkTransformer) Transform(doc *ast.Document, reader text.Reader, pc goldmarkparse.Context) {
+	ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+
+		var dest *[]byte
+		switch node := n.(type) {
+		case *ast.Link:
+			dest = &node.Destination
+		case *ast.Image:
+			dest = &node.Destination
+		default:
+			return ast.WalkContinue, nil
+		}
+
+		resolved, ok := t.resolver.Resolve(t.fpath, string(*dest))
+		if !ok {
+			warn("%s: link to missing file '%s'", t.fpath, *dest)
+		}
+		*dest = []byte(resolved)
+		return ast.WalkContinue, nil
+	})
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLinkResolver(test *testing.T) {
+	test.Parallel()
+
+	tdir := filepath.Join(os.TempDir(), "pagr_test", "TestLinkResolver")
+	files := map[string]string{
+		"guide/setup.md":     "# Setup",
+		"guide/img.png":      string(asset),
+		"blog/post/index.md": "[setup](../../guide/setup.md#install) ![img](../../guide/img.png) [missing](missing.md)",
+	}
+	for fpath, data := range files {
+		fpath = filepath.Join(tdir, fpath)
+		if err := os.MkdirAll(filepath.Dir(fpath), 0775); err != nil {
+			test.Errorf("failed to create temporary test dir: %s", tdir)
+		}
+		if err := ioutil.WriteFile(fpath, []byte(data), 0644); err != nil {
+			test.Error("setup failed:", err)
+		}
+	}
+
+	r := &LinkResolver{Root: tdir, Base: "/docs"}
+	fpath := filepath.Join(tdir, "blog", "post", "index.md")
+	tests := map[string]string{
+		"../../guide/setup.md#install": "/docs/guide/#install",
+		"../../guide/img.png":          "/docs/guide/img.png",
+		"../../guide":                  "/docs/guide/",
+		"../../":                       "/docs/",
+		"https://example.com/x.md":     "https://example.com/x.md",
+		"#top":                         "#top",
+		"/abs/path":                    "/abs/path",
+	}
+	for link, expect := range tests {
+		if resolved, ok := r.Resolve(fpath, link); !ok || resolved != expect {
+			test.Errorf("Resolve('%s') returned '%s', %t (should be '%s')", link, resolved, ok, expect)
+		}
+	}
+	if _, ok := r.Resolve(fpath, "missing.md"); ok {
+		test.Error("Resolve returned ok for missing file")
+	}
+
+	c, err := NewContentFromFile(fpath, r)
+	if err != nil {
+		test.Fatal(err)
+	}
+	for _, expect := range []string{`href="/docs/guide/#install"`, `src="/docs/guide/img.png"`, `href="missing.md"`} {
+		if !strings.Contains(string(c), expect) {
+			test.Errorf("'%s' not found in converted content: %s", expect, c)
+		}
+	}
+
+	if err = os.RemoveAll(tdir); err != nil {
+		test.Error(err)
+	}
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"encoding/binary"
+	"io"
+	"strings"
+	"time"
+)
+
+// readMediaInfo reads the dimensions & duration of the audio/video data in
+// `r`, any values that can't be read are returned as 0.
+// Only ISO base media files (mp4, mov, m4a, etc) and WAV files are supported.
+func readMediaInfo(r io.ReadSeeker, mimetype string) (width, height int, duration time.Duration) {
+	mimetype = strings.SplitN(mimetype, ";", 2)[0]
+	if strings.Contains(mimetype, "wav") {
+		duration = readWavDuration(r)
+	} else {
+		width, height, duration = readMp4Info(r)
+	}
+	return
+}
+
+// readMp4Info walks the boxes of ISO base media file data in `r` to read
+// the duration (from "mvhd") and dimensions (from the first video "tkhd").
+func readMp4Info(r io.ReadSeeker) (width, height int, duration time.Duration) {
+	var walk func(end int64)
+	walk = func(end int64) {
+		for {
+			start, err := r.Seek(0, io.SeekCurrent)
+			if err != nil || (end > 0 && start+8 > end) {
+				return
+			}
+
+			var hdr [8]byte
+			if _, err = io.ReadFull(r, hdr[:]); err != nil {
+				return
+			}
+			size := int64(binary.BigEndian.Uint32(hdr[:4]))
+			box := string(hdr[4:])
+			hdrlen := int64(8)
+			if size == 1 {
+				var large [8]byte
+				if _, err = io.ReadFull(r, large[:]); err != nil {
+					return
+				}
+				size = int64(binary.BigEndian.Uint64(large[:]))
+				hdrlen = 16
+			} else if size == 0 && end > 0 {
+				size = end - start
+			}
+			if size < hdrlen && size != 0 {
+				return
+			}
+
+			switch box {
+			case "moov", "trak":
+				walk(start + size)
+			case "mvhd":
+				duration = readMvhd(r)
+			case "tkhd":
+				if w, h := readTkhd(r); width == 0 && w > 0 {
+					width, height = w, h
+				}
+			}
+
+			if size == 0 {
+				return
+			}
+			if _, err = r.Seek(start+size, io.SeekStart); err != nil {
+				return
+			}
+		}
+	}
+	walk(0)
+	return
+}
+
+func readMvhd(r io.Reader) time.Duration {
+	var version [4]byte
+	if _, err := io.ReadFull(r, version[:]); err != nil {
+		return 0
+	}
+
+	var timescale, length uint64
+	if version[0] == 1 {
+		var buf [28]byte // creation(8) modification(8) timescale(4) duration(8)
+		if _, err := io.ReadFull(r, buf[:]); err != nil {
+			return 0
+		}
+		timescale = uint64(binary.BigEndian.Uint32(buf[16:20]))
+		length = binary.BigEndian.Uint64(buf[20:28])
+	} else {
+		var buf [16]byte // creation(4) modification(4) timescale(4) duration(4)
+		if _, err := io.ReadFull(r, buf[:]); err != nil {
+			return 0
+		}
+		timescale = uint64(binary.BigEndian.Uint32(buf[8:12]))
+		length = uint64(binary.BigEndian.Uint32(buf[12:16]))
+	}
+
+	if timescale == 0 {
+		return 0
+	}
+	return time.Duration(length * uint64(time.Second) / timescale)
+}
+
+func readTkhd(r io.Reader) (width, height int) {
+	var version [4]byte
+	if _, err := io.ReadFull(r, version[:]); err != nil {
+		return
+	}
+
+	skip := 20 // creation(4) modification(4) track_ID(4) reserved(4) duration(4)
+	if version[0] == 1 {
+		skip = 32
+	}
+	skip += 8 + 2 + 2 + 2 + 2 + 36 // reserved, layer, alternate_group, volume, reserved, matrix
+
+	buf := make([]byte, skip+8)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return
+	}
+	width = int(binary.BigEndian.Uint32(buf[skip:skip+4]) >> 16) // 16.16 fixed-point
+	height = int(binary.BigEndian.Uint32(buf[skip+4:skip+8]) >> 16)
+	return
+}
+
+// readWavDuration reads the "fmt " & "data" chunks of RIFF WAVE data in `r`
+// to calculate the duration of the audio.
+func readWavDuration(r io.ReadSeeker) time.Duration {
+	var hdr [12]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil ||
+		string(hdr[:4]) != "RIFF" || string(hdr[8:]) != "WAVE" {
+		return 0
+	}
+
+	var byteRate, dataSize uint64
+	for byteRate == 0 || dataSize == 0 {
+		var chunk [8]byte
+		if _, err := io.ReadFull(r, chunk[:]); err != nil {
+			return 0
+		}
+		size := int64(binary.LittleEndian.Uint32(chunk[4:]))
+		pad := size % 2
+
+		switch string(chunk[:4]) {
+		case "fmt ":
+			var fmtbuf [12]byte // format(2) channels(2) sample_rate(4) byte_rate(4)
+			if _, err := io.ReadFull(r, fmtbuf[:]); err != nil {
+				return 0
+			}
+			byteRate = uint64(binary.LittleEndian.Uint32(fmtbuf[8:]))
+			size -= 12
+		case "data":
+			dataSize = uint64(size)
+		}
+
+		if _, err := r.Seek(size+pad, io.SeekCurrent); err != nil {
+			return 0
+		}
+	}
+	return time.Duration(dataSize * uint64(time.Second) / byteRate)
+}
@@ -0,0 +1,271 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// minifyTypes are the file types that can be minified (by file extension).
+var minifyTypes = map[string]string{
+	".css":  "css",
+	".js":   "js",
+	".mjs":  "js",
+	".html": "html",
+	".htm":  "html",
+	".svg":  "svg",
+	".json": "json",
+}
+
+// sourceLine is a line of text from line `Line` (0-indexed) of the source
+// file at index `Src` of a bundle. Quoted is set if the line starts inside
+// a quoted string (see `stripComments`).
+type sourceLine struct {
+	Text   string
+	Src    int
+	Line   int
+	Quoted bool
+}
+
+// minifyType returns the minify type of `fpath` if it's in `types`,
+// otherwise an empty string.
+func minifyType(fpath string, types []string) string {
+	t := minifyTypes[strings.ToLower(filepath.Ext(fpath))]
+	for _, enabled := range types {
+		if strings.TrimPrefix(strings.ToLower(enabled), ".") == t {
+			return t
+		}
+	}
+	return ""
+}
+
+// stripComments removes all comments from the CSS or JS source `src`, any
+// newlines inside comments are kept so that line numbers are unchanged.
+// Quoted strings (and regular expression literals, when `js` is true)
+// are left untouched. `quoted` is set for each line of the result that
+// starts inside a quoted string (a JS template literal or a string
+// continued with a trailing '\').
+func stripComments(src string, js bool) (out string, quoted []bool) {
+	var buf strings.Builder
+	var quote byte
+	var class bool // inside a regular expression character class
+	var prev byte  // last non-whitespace byte written
+	quoted = []bool{false}
+	for i := 0; i < len(src); i++ {
+		c := src[i]
+		switch {
+		case quote != 0:
+			buf.WriteByte(c)
+			if c == '\\' && i+1 < len(src) {
+				i++
+				buf.WriteByte(src[i])
+				if src[i] == '\n' {
+					quoted = append(quoted, true)
+				}
+				continue
+			}
+			switch {
+			case c == '\n' && (quote == '`' || quote == '/'):
+				quoted = append(quoted, quote == '`')
+			case c == '\n':
+				quote = 0
+				quoted = append(quoted, false)
+			case quote == '/' && c == '[':
+				class = true
+			case quote == '/' && c == ']':
+				class = false
+			case c == quote && !(quote == '/' && class):
+				quote = 0
+			}
+			continue
+		case c == '/' && i+1 < len(src) && src[i+1] == '*':
+			end := strings.Index(src[i+2:], "*/")
+			if end == -1 {
+				end = len(src) - i - 2
+			}
+			for n := strings.Count(src[i:i+2+end], "\n"); n > 0; n-- {
+				buf.WriteByte('\n')
+				quoted = append(quoted, false)
+			}
+			i += end + 3
+			continue
+		case js && c == '/' && i+1 < len(src) && src[i+1] == '/':
+			for i < len(src) && src[i] != '\n' {
+				i++
+			}
+			i--
+			continue
+		case c == '"' || c == '\'' || (js && c == '`'):
+			quote = c
+		case js && c == '/' && (prev == 0 || strings.IndexByte("(,=:[!&|?{};+-*%<>~^", prev) != -1):
+			quote = '/' // regular expression literal
+			class = false
+		case c == '\n':
+			quoted = append(quoted, false)
+		}
+		buf.WriteByte(c)
+		if c != ' ' && c != '\t' && c != '\n' && c != '\r' {
+			prev = c
+		}
+	}
+	return buf.String(), quoted
+}
+
+// minifyCSSLine removes any unnecessary whitespace from a line of CSS.
+// Whitespace before ':' is kept, since it's significant in selectors.
+func minifyCSSLine(line string) string {
+	var out []byte
+	var quote byte
+	space := false
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		if quote != 0 {
+			out = append(out, c)
+			if c == '\\' && i+1 < len(line) {
+				i++
+				out = append(out, line[i])
+			} else if c == quote {
+				quote = 0
+			}
+			continue
+		}
+
+		switch c {
+		case ' ', '\t', '\r', '\n':
+			space = true
+			continue
+		case '"', '\'':
+			quote = c
+		case '}':
+			if len(out) > 0 && out[len(out)-1] == ';' {
+				out = out[:len(out)-1]
+			}
+		}
+		if space && len(out) > 0 && strings.IndexByte("{};,>", c) == -1 &&
+			strings.IndexByte("{};,>:", out[len(out)-1]) == -1 {
+			out = append(out, ' ')
+		}
+		space = false
+		out = append(out, c)
+	}
+	return string(out)
+}
+
+// minifyLines returns the minified `lines` of the CSS or JS file type `t`.
+// Comments, empty lines and leading/trailing whitespace are removed from JS
+// (except inside multi-line strings) and all unnecessary whitespace is
+// removed from CSS (except on lines continuing a string). Lines are never
+// joined, so each result can be mapped back to the source line it came from.
+func minifyLines(lines []sourceLine, t string) (minified []sourceLine) {
+	var src []string
+	for _, l := range lines {
+		src = append(src, l.Text)
+	}
+	out, quoted := stripComments(strings.Join(src, "\n"), t == "js")
+	stripped := strings.Split(out, "\n")
+
+	for i, text := range stripped {
+		// whitespace inside a quoted string is kept, as are empty lines
+		startQuoted := i < len(quoted) && quoted[i]
+		endQuoted := i+1 < len(quoted) && quoted[i+1]
+		if t == "css" && !startQuoted {
+			text = minifyCSSLine(text)
+		} else if t != "css" {
+			if !startQuoted {
+				text = strings.TrimLeft(text, " \t\r")
+			}
+			if !endQuoted {
+				text = strings.TrimRight(text, " \t\r")
+			}
+		}
+		if (len(text) > 0 || startQuoted) && i < len(lines) {
+			minified = append(minified, sourceLine{Text: text, Src: lines[i].Src, Line: lines[i].Line, Quoted: startQuoted})
+		}
+	}
+	return
+}
+
+// lineSeparator returns the separator to write between two lines `a` and
+// `b` of minified CSS or JS. JS lines are always separated by a newline
+// (since semicolons can be implied by them), CSS lines are joined by a
+// single space, unless none is required. Empty lines (only kept inside
+// quoted strings) are separated by a newline.
+func lineSeparator(a, b, t string) string {
+	if t == "js" || len(a) == 0 || len(b) == 0 {
+		return "\n"
+	} else if strings.IndexByte("{};,>", a[len(a)-1]) != -1 || strings.IndexByte("{};,>", b[0]) != -1 {
+		return ""
+	}
+	return " "
+}
+
+var htmlCommentRegexp = regexp.MustCompile(`(?s)<!--[^\[].*?-->`)
+var htmlPreformattedRegexp = regexp.MustCompile(`(?is)<(pre|textarea|script|style)\b.*?</(pre|textarea|script|style)>`)
+var whitespaceRegexp = regexp.MustCompile(`\s+`)
+var xmlBetweenTagsRegexp = regexp.MustCompile(`>\s+<`)
+
+// minifyHTML removes comments and collapses runs of whitespace in `src`.
+// The content of <pre>, <textarea>, <script> and <style> elements is untouched.
+func minifyHTML(src []byte) []byte {
+	src = htmlCommentRegexp.ReplaceAll(src, nil)
+
+	var out bytes.Buffer
+	last := 0
+	for _, loc := range htmlPreformattedRegexp.FindAllIndex(src, -1) {
+		out.Write(whitespaceRegexp.ReplaceAll(src[last:loc[0]], []byte(" ")))
+		out.Write(src[loc[0]:loc[1]])
+		last = loc[1]
+	}
+	out.Write(whitespaceRegexp.ReplaceAll(src[last:], []byte(" ")))
+	return bytes.TrimSpace(out.Bytes())
+}
+
+// minifySVG removes comments and whitespace between the tags of `src`.
+func minifySVG(src []byte) []byte {
+	src = htmlCommentRegexp.ReplaceAll(src, nil)
+	return bytes.TrimSpace(xmlBetweenTagsRegexp.ReplaceAll(src, []byte("><")))
+}
+
+// Minify returns `src` minified as the file type `t` ("css", "js", "html",
+// "svg" or "json"). Unknown types are returned unchanged.
+func Minify(src []byte, t string) (out []byte, err error) {
+	switch t {
+	case "css", "js":
+		var lines []sourceLine
+		for i, l := range strings.Split(string(src), "\n") {
+			lines = append(lines, sourceLine{Text: l, Line: i})
+		}
+		out, _ = joinLines(minifyLines(lines, t), t, true)
+	case "html":
+		out = minifyHTML(src)
+	case "svg":
+		out = minifySVG(src)
+	case "json":
+		var buf bytes.Buffer
+		if err = json.Compact(&buf, src); err == nil {
+			out = buf.Bytes()
+		}
+	default:
+		out = src
+	}
+	return
+}
+
+// MinifyFile writes the file at `src` to `dst`, minified as the file type `t`.
+func MinifyFile(src, dst, t string) (err error) {
+	var buf []byte
+	if buf, err = ioutil.ReadFile(src); err != nil {
+		return
+	}
+	if buf, err = Minify(buf, t); err != nil {
+		return
+	}
+	if err = os.MkdirAll(filepath.Dir(dst), 0755); err == nil {
+		err = replaceFile(dst, buf, 0644)
+	}
+	return
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestMinify(test *testing.T) {
+	test.Parallel()
+
+	tests := []struct {
+		t, in, out string
+	}{
+		{"css", "/* comment */\na :hover ,\nb > c {\n\tcolor: red;\n\tcontent: \"a  b\";\n}\n", `a :hover,b>c{color:red;content:"a  b"}`},
+		{"js", "// comment\nvar a = 1; /* multi\nline */\nvar s = \"// not a comment\";\n\tvar r = /\\/*x/;\n", "var a = 1;\nvar s = \"// not a comment\";\nvar r = /\\/*x/;"},
+		{"js", "var t = `a\n    b  \n\n  c`;\n  var r = /[/]x/; // comment\n", "var t = `a\n    b  \n\n  c`;\nvar r = /[/]x/;"},
+		{"js", "var s = \"a\\\n   b\";\n", "var s = \"a\\\n   b\";"},
+		{"css", "a {\n\tcontent: \"x\\\n\n\";\n}\n", "a{content:\"x\\\n\n\"}"},
+		{"css", "a {\n\tcontent: \"x\\\n  y\";\n}\n", "a{content:\"x\\\n  y\"}"},
+		{"html", "<p>\n  a   <b>b</b>\n</p><!-- comment -->\n<pre>  keep\n  this</pre>", "<p> a <b>b</b> </p> <pre>  keep\n  this</pre>"},
+		{"svg", "<svg>\n  <!-- c -->\n  <path d=\"M0 0\"/>\n</svg>\n", `<svg><path d="M0 0"/></svg>`},
+		{"json", "{\n  \"a\": [1, 2]\n}", `{"a":[1,2]}`},
+	}
+	for _, t := range tests {
+		out, err := Minify([]byte(t.in), t.t)
+		if err != nil {
+			test.Errorf("Minify failed for %s: %s", t.t, err)
+		} else if string(out) != t.out {
+			test.Errorf("invalid %s result:\n%s\nshould be:\n%s", t.t, out, t.out)
+		}
+	}
+
+	if minifyType("a/b.CSS", []string{"js", ".css"}) != "css" || minifyType("a.js", []string{"css"}) != "" {
+		test.Error("invalid minifyType results")
+	}
+}
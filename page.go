@@ -2,9 +2,10 @@ package main
 
 import (
 	"bytes"
-	"io/ioutil"
+	"fmt"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
@@ -39,19 +40,25 @@ func pagePath(root, path string) string {
 type Page struct {
 	Slug     string
 	Path     string
-	Nav      Nav
+	Nav      Nav `json:"-"` // not encoded, since it's cyclic
 	Meta     Meta
 	Contents []Content
 	Assets   Assets
 	Updated  string
+
+	sources      []string // filepaths of the files the page was loaded from
+	contentFiles []string // content files waiting to be converted, see `LoadContentDir`
 }
 
+// Assets is the set of `Asset` files found in the content directory of a
+// Page. `.All` contains every Asset, the other values point to the elements
+// of `.All` with a matching `Asset.MediaType()` (anything else is in `.Misc`).
 type Assets struct {
-	All   []string
-	Audio []*string
-	Image []*string
-	Video []*string
-	Misc  []*string
+	All   []Asset
+	Audio []*Asset
+	Image []*Asset
+	Video []*Asset
+	Misc  []*Asset
 }
 
 // Nav is a struct that provides a set of pointers for navigating a
@@ -80,6 +87,38 @@ func (m Meta) MergeMeta(meta Meta, overwrite bool) {
 	}
 }
 
+// metaValue returns the value of the first key in `keys` found in `m`.
+func metaValue(m Meta, keys ...string) (v interface{}, ok bool) {
+	for _, k := range keys {
+		if v, ok = m[k]; ok {
+			break
+		}
+	}
+	return
+}
+
+// metaStrings returns `v` as a list of strings, a string value is split on ','.
+func metaStrings(v interface{}) (list []string) {
+	switch val := v.(type) {
+	case []interface{}:
+		for _, s := range val {
+			list = append(list, fmt.Sprint(s))
+		}
+	case []string:
+		list = append(list, val...)
+	case string:
+		for _, s := range strings.Split(val, ",") {
+			if s = strings.TrimSpace(s); len(s) > 0 {
+				list = append(list, s)
+			}
+		}
+	case nil:
+	default:
+		list = append(list, fmt.Sprint(val))
+	}
+	return
+}
+
 // NewPage returns a Page with init values. `.Path` will be set to `path`.
 // Updated is set to time.Now(). Any other values will simply be initialised.
 func NewPage(path string, updated time.Time) Page {
@@ -108,23 +147,95 @@ func (p *Page) TemplateName(defaultName string) string {
 	}
 }
 
+// Draft returns true if the `draft` or `Draft` key in `p.Meta` is true,
+// draft pages are only loaded if `config.Drafts` is set.
+func (p *Page) Draft() bool {
+	v, _ := metaValue(p.Meta, "draft", "Draft")
+	draft, _ := strconv.ParseBool(fmt.Sprint(v))
+	return draft
+}
+
+// skipDraft returns true if `p` is a draft that isn't built (see `Draft`).
+func (p *Page) skipDraft() bool {
+	if p.Draft() && !config.Drafts {
+		vlog("skipping draft page %s", p.Path)
+		return true
+	}
+	return false
+}
+
+// Section returns the first element of `p.Path` (e.g. "blog" for
+// "/blog/post"), or an empty string for the root page.
+func (p *Page) Section() string {
+	return strings.SplitN(strings.Trim(p.Path, "/"), "/", 2)[0]
+}
+
+// Kind returns "list" if `p` has any child pages, otherwise "single".
+func (p *Page) Kind() string {
+	if len(p.Nav.Children) > 0 {
+		return "list"
+	}
+	return "single"
+}
+
+// TemplateChain returns the names of the templates to look up for `p`, in
+// order: the `template` key in `p.Meta`, the section of `p` (see
+// `Section`), the kind of `p` (see `Kind`) and `defaultName`.
+func (p *Page) TemplateChain(defaultName string) (chain []string) {
+	if name := p.TemplateName(""); len(name) > 0 {
+		chain = append(chain, name)
+	}
+	if section := p.Section(); len(section) > 0 {
+		chain = append(chain, section)
+	}
+	return append(chain, p.Kind(), defaultName)
+}
+
+// Outputs will check if `p.Meta` has the key `outputs` or `Outputs` (in that
+// order) and return the value of the first existing key as a list of output
+// format names (e.g. "html", "json", "txt").
+// If neither key exists, it will return `["html"]`.
+func (p *Page) Outputs() (outputs []string) {
+	if v, ok := metaValue(p.Meta, "outputs", "Outputs"); ok {
+		outputs = metaStrings(v)
+	}
+	if len(outputs) == 0 {
+		outputs = []string{"html"}
+	}
+	return
+}
+
 // Build will run `t.Execute(p)` and write the result to
 // `outDir/p.Path/index.html`.
 func (p *Page) Build(outDir string, t suti.Template) (out string, err error) {
+	return p.BuildOutput(outDir, "index.html", t)
+}
+
+// BuildOutput will run `t.Execute(p)` and write the result to
+// `outDir/p.Path/fname`.
+func (p *Page) BuildOutput(outDir, fname string, t suti.Template) (out string, err error) {
 	var buf bytes.Buffer
 	if buf, err = t.Execute(p); err == nil {
-		out = filepath.Join(outDir, p.Path, "index.html")
+		out = filepath.Join(outDir, p.Path, fname)
 		if err = os.MkdirAll(filepath.Dir(out), 0755); err == nil {
-			err = ioutil.WriteFile(out, buf.Bytes(), 0644)
+			err = replaceFile(out, buf.Bytes(), 0644)
 		}
 	}
 	return out, err
 }
 
-// call `NewContentFromFile` and append it to `p.Contents`
-func (p *Page) NewContentFromFile(fpath string) (err error) {
+// call `NewContentFromFile` and append it to `p.Contents`, any shortcodes in
+// the file are rendered with `p` as their page.
+func (p *Page) NewContentFromFile(fpath string, links *LinkResolver) (err error) {
+	if err = p.convertContentFile(fpath, links); err == nil {
+		p.sources = append(p.sources, fpath)
+	}
+	return
+}
+
+func (p *Page) convertContentFile(fpath string, links *LinkResolver) (err error) {
 	var c Content
-	if c, err = NewContentFromFile(fpath); err == nil {
+	if c, err = newContentFromFile(fpath, links, p); err == nil {
 		p.Contents = append(p.Contents, c)
 	}
 	return
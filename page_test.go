@@ -5,6 +5,7 @@ import (
 	"notabug.org/gearsix/suti"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 )
@@ -73,6 +74,48 @@ func TestTemplateName(test *testing.T) {
 	}
 }
 
+func TestTemplateChain(test *testing.T) {
+	test.Parallel()
+
+	root := NewPage("/", time.Now())
+	post := NewPage("/blog/post", time.Now())
+	root.Nav.Children = []*Page{&post}
+
+	for _, c := range []struct {
+		p      Page
+		expect string
+	}{
+		{root, "list,default"},
+		{post, "blog,single,default"},
+	} {
+		if chain := strings.Join(c.p.TemplateChain("default"), ","); chain != c.expect {
+			test.Errorf("TemplateChain for %s returned '%s' (should be '%s')", c.p.Path, chain, c.expect)
+		}
+	}
+
+	post.Meta["template"] = "post"
+	if chain := strings.Join(post.TemplateChain("default"), ","); chain != "post,blog,single,default" {
+		test.Errorf("TemplateChain returned '%s' for a page with a template set", chain)
+	}
+}
+
+func TestOutputs(test *testing.T) {
+	test.Parallel()
+
+	p := NewPage("/test", time.Now())
+	if o := p.Outputs(); len(o) != 1 || o[0] != "html" {
+		test.Fatalf("invalid default Outputs(): %v", o)
+	}
+	p.Meta["Outputs"] = "html, txt"
+	if o := p.Outputs(); len(o) != 2 || o[1] != "txt" {
+		test.Fatalf("invalid Outputs() for string value: %v", o)
+	}
+	p.Meta["outputs"] = []interface{}{"html", "json", "txt"}
+	if o := p.Outputs(); len(o) != 3 || o[1] != "json" {
+		test.Fatalf("invalid Outputs() for list value: %v", o)
+	}
+}
+
 func TestBuild(test *testing.T) {
 	test.Parallel()
 
@@ -99,6 +142,12 @@ func TestBuild(test *testing.T) {
 		test.Fatalf("invalid result parsed: '%s', expected: 'Test p'", string(fbuf))
 	}
 
+	if fpath, err = p.BuildOutput(tdir, "index.json", t); err != nil {
+		test.Fatal(err)
+	} else if fpath != filepath.Join(tdir, p.Path, "index.json") {
+		test.Fatalf("BuildOutput wrote to '%s'", fpath)
+	}
+
 	if err := os.RemoveAll(tdir); err != nil {
 		test.Error(err)
 	}
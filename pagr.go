@@ -1,13 +1,18 @@
 package main
 
 import (
-	"flag"
+	"fmt"
 	"log"
+	"net"
+	"net/http"
 	"notabug.org/gearsix/suti"
 	"os"
 	"os/exec"
+	"path"
 	"path/filepath"
+	"sort"
 	"strings"
+	"time"
 )
 
 const Name = "pagr"
@@ -17,6 +22,16 @@ var gitBin string
 var config Config
 var flagConfig string
 var flagVerbose bool
+var flagCheck bool
+var flagClean bool
+var flagDryRun bool
+var flagReport string
+var flagStrict bool
+var flagFormat string
+
+// devMode is set when serving the project (`pagr serve`): build errors don't
+// exit and template errors are written as error pages, see `serve`.
+var devMode bool
 
 var ilog = log.New(os.Stdout, "", 0)
 var elog = log.New(os.Stderr, "", 0)
@@ -27,9 +42,21 @@ func vlog(fmt string, args ...interface{}) {
 	}
 }
 
+// buildError is the panic value used by `check` in `devMode`, so a failed
+// build can be recovered from (see `rebuild`).
+type buildError struct{ error }
+
 func check(err error) {
 	if err != nil {
-		if flagVerbose {
+		report.Error(err)
+		if devMode {
+			elog.Printf("ERROR! %s\n", err)
+			panic(buildError{err})
+		} else if len(flagReport) > 0 {
+			elog.Printf("ERROR! %s\n", err)
+			writeReport()
+			os.Exit(ExitError)
+		} else if flagVerbose {
 			elog.Panic(err.Error())
 		} else {
 			elog.Fatalf("ERROR! %s\n", err)
@@ -37,60 +64,464 @@ func check(err error) {
 	}
 }
 
+func warn(format string, args ...interface{}) {
+	msg := fmt.Sprintf(format, args...)
+	report.Warn(msg)
+	elog.Printf("WARNING! %s\n", msg)
+}
+
 func ignoreFile(filepath string) bool {
 	return strings.Contains(filepath, ".ignore")
 }
 
 func init() {
-	flag.BoolVar(&flagVerbose, "v", false, "print verbose ilog.")
-	flag.StringVar(&flagConfig, "cfg", "", "path to pagr project configuration file")
 	gitBin, _ = exec.LookPath("git")
 }
 
 func main() {
-	flag.Parse()
+	cmd, args := parseCommand(os.Args[1:])
 	vlog("verbose on")
-	config = loadConfigFile()
-	vlog("loaded config: %s\n", config)
+	if len(flagReport) > 0 {
+		ilog.SetOutput(os.Stderr)
+		if format := flagReport; format != "json" {
+			flagReport = ""
+			check(fmt.Errorf("invalid report format '%s'", format))
+		}
+	}
+	if !cmd.NoConfig {
+		config = loadConfig()
+		vlog("loaded config: %+v\n", config)
+	}
 
+	cmd.Run(args)
+}
+
+// loadThemes loads the themes used by `config` and returns them, with the
+// template directories of the project (see `themePaths`).
+func loadThemes() (themes []Theme, templateDirs []string) {
 	var err error
+	themes, err = LoadThemes(config.ThemesDir, config.ThemeNames())
+	check(err)
+	if len(themes) > 0 {
+		vlog("using themes: %s", strings.Join(config.ThemeNames(), ", "))
+	}
+	return themes, themePaths(themes, themeTemplatesDir, config.Templates)
+}
+
+// build builds the project in `config`.
+func build() {
+	var err error
+	output := config.Output
+	if config.Staging {
+		config.Output, err = BeginStaging(output, config.Keep)
+		check(err)
+		vlog("building to staging directory %s", config.Output)
+	}
+
+	themes, templateDirs := loadThemes()
+
+	translations, err = LoadI18nDir(themePaths(themes, themeI18nDir, config.I18n)...)
+	check(err)
+	vlog("loaded translations for %d languages", len(translations))
+	shortcodes, err = LoadShortcodeDir(joinPaths(templateDirs, shortcodesDir)...)
+	check(err)
+	vlog("loaded %d shortcodes", len(shortcodes))
+	renderHooks, err = LoadRenderHookDir(joinPaths(templateDirs, hooksDir)...)
+	check(err)
+	vlog("loaded %d render hooks", len(renderHooks))
+
 	var content []Page
-	content, err = LoadContentDir(config.Contents)
+	content, err = LoadContentDir(config.Contents, themes...)
 	check(err)
 	ilog.Printf("loaded %d content pages", len(content))
 
+	if len(config.Generators) > 0 {
+		var generated []Page
+		generated, err = LoadGeneratedPages(config.Generators, themes...)
+		check(err)
+		content = BuildSitemap(append(content, generated...))
+		ilog.Printf("generated %d data pages", len(generated))
+	}
+
+	sitePages = content
+
 	var templates []suti.Template
-	templates, err = LoadTemplateDir(config.Templates)
+	if devMode {
+		var terrs []*TemplateError
+		templates, terrs, err = LoadDevTemplateDir(templateDirs...)
+		for _, terr := range terrs {
+			warn("%s", terr)
+		}
+	} else {
+		templates, err = LoadTemplateDir(templateDirs...)
+	}
 	check(err)
 	ilog.Printf("loaded %d template files", len(templates))
 
 	ilog.Println("copying assets...")
-	assetc := copyAssets()
+	assetc := copyAssets(themePaths(themes, themeAssetsDir, config.Assets...))
+	assetc += writeBundles()
+
+	if config.Fingerprint {
+		for _, p := range content {
+			for i, a := range p.Assets.All {
+				p.Assets.All[i].URL = manifest.Add(a.URL, a.Hash)
+			}
+		}
+	}
 
 	ilog.Println("building project...")
 	pagec := 0
+	sources := make(map[string][]string)
+	var indexed []Page // the pages with a html output written, see `WriteSearchIndex`
 	for _, p := range content {
 		vlog("+ %s", p.Path)
 
-		_, err = p.Build(config.Output, findPageTemplate(p, templates))
-		if err != nil {
-			ilog.Printf("skipping %s: %s\n", p.Path, err)
+		for _, img := range p.Assets.Image {
+			check(config.Images.Process(img, config.Output))
+			wroteAsset(img.Path, img.URL)
+			for _, v := range img.Variants {
+				wroteAsset(img.Path, v.URL)
+			}
+			if len(img.Thumbnail) > 0 {
+				wroteAsset(img.Path, img.Thumbnail)
+			}
+			vlog("\t-> %s (%d variants)\n", img.URL, len(img.Variants))
+		}
+
+		built := 0
+		for _, format := range p.Outputs() {
+			fname := config.OutputFile(format)
+			var tmpl suti.Template
+			tmpl, err = findPageTemplate(p, format, templates)
+			start := time.Now()
+			var out string
+			if err == nil {
+				out, err = p.BuildOutput(config.Output, fname, tmpl)
+				if err != nil && devMode {
+					warn("%s (%s): %s", p.Path, fname, err)
+					out = filepath.Join(config.Output, p.Path, fname)
+					err = writeErrorPageFile(out, NewTemplateError(err, templateDirs...))
+				} else if err != nil {
+					if terr := NewTemplateError(err, templateDirs...); len(terr.File) > 0 {
+						err = terr // include the template file & line
+					}
+				}
+			}
+			if err != nil {
+				err = fmt.Errorf("%s (%s, from %s): %s", p.Path, fname, strings.Join(p.sources, ", "), err)
+				if config.Strict {
+					check(err)
+				}
+				warn("skipping %s", err)
+				continue
+			}
+			sources[out] = p.sources
+			written.Add(out)
+			report.AddPage(p, format, tmpl.Name, config.Output, out, time.Since(start))
+			if format == "html" {
+				indexed = append(indexed, p)
+			}
+			built++
+		}
+		if built == 0 {
 			continue
 		}
 
 		for _, asset := range p.Assets.All {
-			src := filepath.Join(config.Contents, asset)
-			dst := filepath.Join(config.Output, asset)
-			check(CopyFile(src, dst))
-			vlog("\t-> %s\n", asset)
+			if asset.MediaType() == "image" {
+				continue
+			}
+			check(copyAsset(asset.Path, filepath.Join(config.Output, asset.URL)))
+			wroteAsset(asset.Path, asset.URL)
+			vlog("\t-> %s\n", asset.URL)
 		}
 
 		pagec++
 		assetc += len(p.Assets.All)
 	}
 
+	if config.Fingerprint {
+		for out := range written {
+			if isHTMLFile(out) || strings.ToLower(filepath.Ext(out)) == ".css" {
+				dir, _ := filepath.Rel(config.Output, filepath.Dir(out))
+				check(manifest.RewriteFile(out, config.BasePath, filepath.ToSlash(dir)))
+			}
+		}
+		check(manifest.Write(filepath.Join(config.Output, config.Manifest)))
+		written.Add(filepath.Join(config.Output, config.Manifest))
+		vlog("wrote asset manifest %s", config.Manifest)
+	}
+
+	if len(config.Minify) > 0 {
+		for out := range sources {
+			if t := minifyType(out, config.Minify); len(t) > 0 {
+				check(MinifyFile(out, out, t))
+			}
+		}
+	}
+
+	if len(config.Search.Output) > 0 {
+		var index string
+		index, err = WriteSearchIndex(indexed, config.Search, config.Output)
+		check(err)
+		written.Add(index)
+		vlog("wrote search index %s", index)
+	}
+
 	ilog.Printf("generated %d html files, copied %d asset files\n", pagec, assetc)
+
+	if flagCheck {
+		checkLinks(sources)
+	}
+
+	if flagClean || flagDryRun {
+		cleanOutput(output)
+	}
+
+	if config.Staging {
+		check(CommitStaging(config.Output, output, config.Keep))
+		vlog("moved %s to %s (previous build kept at %s)", config.Output, output, backupDir(output))
+		config.Output = output
+	}
+
 	ilog.Println("pagr success")
+}
+
+// serve builds the project in development mode (see `devMode`), serves
+// `config.Output` over HTTP at `addr` and rebuilds it whenever a file in
+// `servePaths` changes. If the config file changes, it's reloaded first.
+func serve(addr string) {
+	listener, err := net.Listen("tcp", addr)
+	check(err)
+
+	devMode = true
+	config.Staging = false
+	watcher := newDirWatcher(servePaths()...)
+	rebuild(false)
+
+	go func() {
+		if err := http.Serve(listener, http.FileServer(http.Dir(config.Output))); err != nil {
+			elog.Fatalf("ERROR! %s\n", err)
+		}
+	}()
+	ilog.Printf("serving %s at http://%s\n", config.Output, listener.Addr())
+
+	for {
+		time.Sleep(watchInterval)
+		if changed := watcher.Changed(); len(changed) > 0 {
+			vlog("changed: %s", strings.Join(changed, ", "))
+			ilog.Printf("%d files changed, rebuilding...\n", len(changed))
+			reload := false
+			for _, fpath := range changed {
+				reload = reload || (len(flagConfig) > 0 && fpath == flagConfig)
+			}
+			rebuild(reload)
+			if reload {
+				watcher = newDirWatcher(servePaths()...)
+			}
+		}
+	}
+}
+
+// servePaths returns the files & directories watched for changes by `serve`:
+// the templates, content, themes, translations, assets, generator sources,
+// bundle files and the config file of the project.
+func servePaths() []string {
+	paths := []string{config.Templates, config.Contents, config.ThemesDir, config.I18n}
+	paths = append(paths, config.Assets...)
+	for _, g := range config.Generators {
+		paths = append(paths, g.Source)
+	}
+	for _, b := range config.Bundles {
+		paths = append(paths, b.Files...)
+	}
+	if len(flagConfig) > 0 {
+		paths = append(paths, flagConfig)
+	}
+	return paths
+}
+
+// rebuild resets the state of any previous build and calls `build`,
+// recovering if it fails (see `check`). If `reload` is true, the config
+// file is reloaded first (the served `config.Output` doesn't change).
+func rebuild(reload bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			if _, ok := r.(buildError); !ok {
+				panic(r)
+			}
+			elog.Println("build failed, waiting for changes...")
+		}
+	}()
+	if reload {
+		output := config.Output
+		config = loadConfig()
+		config.Output = output
+		config.Staging = false
+	}
+	written = make(OutputSet)
+	manifest = make(Manifest)
+	report = NewBuildReport()
+	build()
+}
+
+// wroteAsset records that the asset file `src` was written to the URL path
+// `url` in `config.Output`.
+func wroteAsset(src, url string) {
+	written.AddURL(config.Output, url)
+	report.AddAsset(src, url)
+}
+
+// writeReport writes `report` to stdout, in the `flagReport` format.
+func writeReport() {
+	if err := report.Write(os.Stdout, config.Output); err != nil {
+		elog.Printf("ERROR! failed to write report: %s\n", err)
+	}
+}
+
+// cleanOutput removes (or lists, if `flagDryRun` is set) all the files in
+// `config.Output` that were not written in this build. Files are listed by
+// their path in the output directory `out` (which `config.Output` is a
+// staging directory for, when `config.Staging` is set).
+func cleanOutput(out string) {
+	stale, err := written.Stale(config.Output, config.Keep)
+	if os.IsNotExist(err) {
+		return
+	}
+	check(err)
+	for _, fpath := range stale {
+		rel, _ := filepath.Rel(config.Output, fpath)
+		if flagDryRun {
+			ilog.Printf("would remove %s\n", filepath.Join(out, rel))
+		} else {
+			vlog("removing %s\n", filepath.Join(out, rel))
+		}
+	}
+	if !flagDryRun {
+		check(RemoveStale(config.Output, stale))
+		ilog.Printf("removed %d stale files\n", len(stale))
+	}
+}
+
+// newProject runs the "new" command with `args`, either
+// "site DIR" (see `NewSite`) or "page PATH" (see `NewContentPage`).
+func newProject(args []string) {
+	if len(args) != 2 || (args[0] != "site" && args[0] != "page") {
+		check(fmt.Errorf("usage: %s new site DIR | %s new page PATH", Name, Name))
+	}
+
+	var created []string
+	var err error
+	if args[0] == "site" {
+		created, err = NewSite(args[1], flagFormat)
+	} else {
+		themes, _ := loadThemes()
+		archetypeDirs := themePaths(themes, themeArchetypesDir, config.Archetypes)
+		created, err = NewContentPage(config.Contents, args[1], archetypeDirs, flagFormat, time.Now())
+	}
+	for _, fpath := range created {
+		vlog("created %s", fpath)
+	}
+	check(err)
+	ilog.Printf("created %s (%d files)\n", strings.TrimSuffix(args[1], "/"), len(created))
+}
+
+// list prints the path of each page in the project, with the output file
+// and template of each of it's output formats.
+func list([]string) {
+	themes, templateDirs := loadThemes()
+	content, err := LoadContentDir(config.Contents, themes...)
+	check(err)
+	if len(config.Generators) > 0 {
+		var generated []Page
+		generated, err = LoadGeneratedPages(config.Generators, themes...)
+		check(err)
+		content = BuildSitemap(append(content, generated...))
+	}
+	sort.SliceStable(content, func(i, j int) bool { return content[i].Path < content[j].Path })
+
+	templates, err := LoadTemplateDir(templateDirs...)
+	check(err)
+	for _, p := range content {
+		for _, format := range p.Outputs() {
+			name := "(no template)"
+			if tmpl, err := findPageTemplate(p, format, templates); err == nil {
+				name = tmpl.Name
+			}
+			ilog.Printf("%s\t%s\t%s\n", p.Path, path.Join(p.Path, config.OutputFile(format)), name)
+		}
+	}
+}
+
+// deploy deploys `config.Output` to the deploy targets in `config.Deploy`
+// named in `names`, or all of them if `names` is empty.
+func deploy(names []string) {
+	if _, err := os.Stat(config.Output); err != nil {
+		check(fmt.Errorf("nothing to deploy: %s", err))
+	}
+
+	deployed := 0
+	for _, t := range config.Deploy {
+		if len(names) > 0 {
+			found := false
+			for _, n := range names {
+				found = found || n == t.Name
+			}
+			if !found {
+				continue
+			}
+		}
+
+		ilog.Printf("deploying to %s (%s)...\n", t.Name, t.Type)
+		diff, err := Deploy(t, config.Output, config.Keep, flagDryRun)
+		check(err)
+		prefix := ""
+		if flagDryRun {
+			prefix = "would "
+		}
+		for _, p := range diff.Upload {
+			vlog("\t%supload %s", prefix, p)
+		}
+		for _, p := range diff.Delete {
+			vlog("\t%sdelete %s", prefix, p)
+		}
+		if t.Type != DeployRsync {
+			ilog.Printf("%suploaded %d files, %sdeleted %d files\n", prefix, len(diff.Upload), prefix, len(diff.Delete))
+		}
+		deployed++
+	}
+	if deployed == 0 {
+		check(fmt.Errorf("no deploy targets found (%s)", strings.Join(names, ", ")))
+	}
+}
+
+func checkLinks(sources map[string][]string) {
+	ilog.Println("checking links...")
+	checker := LinkChecker{
+		Root:     config.Output,
+		Base:     config.BasePath,
+		Sources:  sources,
+		External: config.CheckExternal,
+	}
+	broken, err := checker.Check()
+	check(err)
+	for _, b := range broken {
+		elog.Println(b)
+		report.Error(b)
+	}
+	if len(broken) > 0 {
+		check(fmt.Errorf("found %d broken links", len(broken)))
+	}
+	ilog.Println("no broken links found")
+}
+
+// loadConfig loads the config file (see `loadConfigFile`) and applies the
+// -strict flag and config overrides (see `applyConfigFlags`) to it.
+func loadConfig() (cfg Config) {
+	cfg = loadConfigFile()
+	cfg.Strict = cfg.Strict || flagStrict
+	check(applyConfigFlags(&cfg))
 	return
 }
 
@@ -106,18 +537,53 @@ func loadConfigFile() Config {
 	}
 }
 
-func findPageTemplate(p Page, t []suti.Template) (tmpl suti.Template) {
-	ptmpl := p.TemplateName(config.DefaultTemplate)
-	for i, template := range t {
-		if template.Name == ptmpl {
-			return t[i]
+// findPageTemplate returns the template in `t` to execute `p` with for the
+// output `format`, looking up each name in `p.TemplateChain` in order.
+// For "html" the names are matched as-is or with a ".html" suffix, for other
+// formats they're matched with a ".`format`" suffix (e.g. "blog.json").
+// If `config.Strict` is set, the template set in `p.Meta` must exist.
+func findPageTemplate(p Page, format string, t []suti.Template) (tmpl suti.Template, err error) {
+	var names []string
+	for _, name := range p.TemplateChain(config.DefaultTemplate) {
+		if format == "html" {
+			names = append(names, name, name+".html")
+		} else {
+			names = append(names, name+"."+format)
 		}
 	}
+
+	// in strict mode, a `template` set in the Meta must exist (in any format)
+	if name := p.TemplateName(""); config.Strict && len(name) > 0 {
+		found := false
+		for _, template := range t {
+			found = found || template.Name == name || strings.HasPrefix(template.Name, name+".")
+		}
+		if !found {
+			return tmpl, fmt.Errorf("template '%s' set in Meta not found", name)
+		}
+	}
+
+	for _, n := range names {
+		for i, template := range t {
+			if template.Name == n {
+				vlog("\ttemplate chain (%s): %s -> using '%s'", format, strings.Join(names, ", "), n)
+				return t[i], nil
+			}
+		}
+	}
+	err = fmt.Errorf("no template found (tried: %s)", strings.Join(names, ", "))
 	return
 }
 
-func copyAssets() (count int) {
-	for _, asset := range config.Assets {
+// copyAssets copies the files in each directory in `dirs` to
+// `config.Output`, files in later `dirs` override files in earlier `dirs`
+// that are written to the same output path (see `assetOutputs`).
+func copyAssets(dirs []string) (count int) {
+	outputs := make([]map[string]bool, len(dirs))
+	for i, dir := range dirs {
+		outputs[i] = assetOutputs(dir, config.Preprocessors)
+	}
+	for n, asset := range dirs {
 		asset = filepath.Clean(asset)
 		if _, err := os.Stat(asset); err != nil {
 			continue
@@ -126,13 +592,36 @@ func copyAssets() (count int) {
 			func(path string, info os.FileInfo, err error) error {
 				if err == nil && !info.IsDir() && !ignoreFile(path) {
 					dst := strings.TrimPrefix(filepath.Clean(path), asset)
-					err = CopyFile(path, filepath.Join(config.Output, dst))
+					rel := strings.TrimPrefix(dst, string(filepath.Separator))
+					if overridden(assetOutput(rel, config.Preprocessors), outputs[n+1:]) {
+						return nil
+					}
+					if pp, ok := findPreprocessor(path, config.Preprocessors); ok {
+						if pp.isPartial(path) {
+							return nil
+						}
+						minify := minifyType(pp.OutputPath(path), config.Minify)
+						dst, err = preprocessAsset(pp, path, dst, config.Output, minify, config.Fingerprint)
+					} else {
+						if config.Fingerprint {
+							var hash string
+							if hash, err = hashFile(path); err == nil {
+								dst = manifest.Add(dst, hash)
+							}
+						}
+						if err == nil {
+							err = copyAsset(path, filepath.Join(config.Output, dst))
+						}
+					}
+					if err == nil {
+						wroteAsset(path, dst)
+					}
 					vlog("\t-> %s\n", dst)
 					count++
 				}
 
 				if err != nil {
-					ilog.Printf("copy failed for %s: %s\n", path, err)
+					warn("copy failed for %s: %s", path, err)
 					err = nil
 				}
 
@@ -141,3 +630,33 @@ func copyAssets() (count int) {
 	}
 	return
 }
+
+// copyAsset copies the file at `src` to `dst`, if it's file type is in
+// `config.Minify` it's minified.
+func copyAsset(src, dst string) error {
+	if t := minifyType(src, config.Minify); len(t) > 0 {
+		return MinifyFile(src, dst, t)
+	}
+	return CopyFile(src, dst)
+}
+
+func writeBundles() (count int) {
+	for _, b := range config.Bundles {
+		minify := len(minifyType(b.Output, config.Minify)) > 0
+		url, err := WriteBundle(b, config.Output, minify, config.Fingerprint, config.SourceMaps)
+		if err != nil {
+			warn("bundle failed for %s: %s", b.Output, err)
+			continue
+		}
+		for _, f := range b.Files {
+			report.AddAsset(f, url)
+		}
+		written.AddURL(config.Output, url)
+		if config.SourceMaps {
+			written.AddURL(config.Output, url+".map")
+		}
+		vlog("\t-> %s (%d files)\n", url, len(b.Files))
+		count++
+	}
+	return
+}
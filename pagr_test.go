@@ -1,12 +1,17 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"os"
+	"path"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
+
+	"notabug.org/gearsix/suti"
 )
 
 /* shared *_test.go functions, since pagr.go doesn't have anything that requires testing */
@@ -244,3 +249,253 @@ func validateTestPages(t *testing.T, pages []Page, e error) {
 		}
 	}
 }
+
+// TestBuildOutput isn't parallel, since `build` uses the global `config`.
+func TestBuildOutput(test *testing.T) {
+	tdir := filepath.Join(os.TempDir(), "pagr_test", "TestBuildOutput")
+	files := map[string]string{
+		"content/index.md":       "# home",
+		"templates/default.hmpl": "{{.Meta.Title}}",
+		"out/unrelated.txt":      "keep me",
+	}
+	for fname, data := range files {
+		fpath := filepath.Join(tdir, fname)
+		if err := os.MkdirAll(filepath.Dir(fpath), 0775); err != nil {
+			test.Fatal("setup failed:", err)
+		}
+		if err := ioutil.WriteFile(fpath, []byte(data), 0644); err != nil {
+			test.Fatal("setup failed:", err)
+		}
+	}
+
+	defer func(cfg Config) { config = cfg }(config)
+	config = NewConfig()
+	if !config.Staging {
+		test.Error("Staging isn't set by default")
+	}
+	config.relPaths(tdir)
+	out := config.Output
+	for _, staging := range []bool{false, true} {
+		config.Staging = staging
+		build()
+		if config.Output != out {
+			test.Fatalf("config.Output is '%s' after the build (should be '%s')", config.Output, out)
+		}
+		if _, err := os.Stat(filepath.Join(out, "index.html")); err != nil {
+			test.Error(err)
+		}
+		if buf, err := ioutil.ReadFile(filepath.Join(out, "unrelated.txt")); err != nil || string(buf) != "keep me" {
+			test.Errorf("build (Staging: %t) didn't keep an unrelated file in Output: '%s' (%v)", staging, buf, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(tdir, "out.bak", "unrelated.txt")); err != nil {
+		test.Error("previous build wasn't kept:", err)
+	}
+
+	if err := os.RemoveAll(tdir); err != nil {
+		test.Error(err)
+	}
+}
+
+// TestBuildHardlink isn't parallel, since `build` uses the global `config`.
+func TestBuildHardlink(test *testing.T) {
+	tdir := filepath.Join(os.TempDir(), "pagr_test", "TestBuildHardlink")
+	files := map[string]string{
+		"content/index.md":       "# home",
+		"content/page.css":       "b {\n\tcolor: blue;\n}\n",
+		"templates/default.hmpl": "{{.Meta.Title}}",
+		"assets/style.css":       "a {\n\tcolor: red;\n}\n",
+	}
+	for fname, data := range files {
+		fpath := filepath.Join(tdir, fname)
+		if err := os.MkdirAll(filepath.Dir(fpath), 0775); err != nil {
+			test.Fatal("setup failed:", err)
+		}
+		if err := ioutil.WriteFile(fpath, []byte(data), 0644); err != nil {
+			test.Fatal("setup failed:", err)
+		}
+	}
+
+	defer func(cfg Config) { config = cfg }(config)
+	config = NewConfig()
+	config.relPaths(tdir)
+	config.CopyMode = CopyModeHardlink
+	config.Staging = false // the staging directory is a copy, not a link
+	// the first build links the output to the sources, the second replaces them
+	for _, minify := range [][]string{nil, {"css"}} {
+		config.Minify = minify
+		build()
+		if buf, err := ioutil.ReadFile(filepath.Join(config.Output, "style.css")); err != nil {
+			test.Error(err)
+		} else if len(minify) > 0 && string(buf) != "a{color:red}" {
+			test.Errorf("invalid minified output: '%s'", buf)
+		}
+		for _, fname := range []string{"assets/style.css", "content/page.css"} {
+			if buf, err := ioutil.ReadFile(filepath.Join(tdir, fname)); err != nil || string(buf) != files[fname] {
+				test.Errorf("build modified the source file '%s': '%s' (%v)", fname, buf, err)
+			}
+		}
+	}
+
+	if err := os.RemoveAll(tdir); err != nil {
+		test.Error(err)
+	}
+}
+
+// TestBuildFingerprint isn't parallel, since `build` uses the global `config`.
+func TestBuildFingerprint(test *testing.T) {
+	tdir := filepath.Join(os.TempDir(), "pagr_test", "TestBuildFingerprint")
+	files := map[string]string{
+		"content/index.html":     `<link href="css/style.css">`,
+		"templates/default.tmpl": "{{range .Contents}}{{.}}{{end}}",
+		"assets/css/style.css":   "a { background: url(../img/a.png); }",
+		"assets/img/a.png":       "png",
+	}
+	for fname, data := range files {
+		fpath := filepath.Join(tdir, fname)
+		if err := os.MkdirAll(filepath.Dir(fpath), 0775); err != nil {
+			test.Fatal("setup failed:", err)
+		}
+		if err := ioutil.WriteFile(fpath, []byte(data), 0644); err != nil {
+			test.Fatal("setup failed:", err)
+		}
+	}
+
+	defer func(cfg Config, m Manifest, w OutputSet) {
+		config, manifest, written = cfg, m, w
+	}(config, manifest, written)
+	config = NewConfig()
+	config.relPaths(tdir)
+	config.Fingerprint = true
+	config.Staging = false
+	manifest, written = make(Manifest), make(OutputSet)
+	build()
+
+	css, png := manifest.URL("/css/style.css"), manifest.URL("/img/a.png")
+	if css == "/css/style.css" || png == "/img/a.png" {
+		test.Fatalf("assets weren't fingerprinted: %v", manifest)
+	}
+	if buf, err := ioutil.ReadFile(filepath.Join(config.Output, "index.html")); err != nil {
+		test.Error(err)
+	} else if expect := `<link href="css/` + path.Base(css) + `">`; !strings.Contains(string(buf), expect) {
+		test.Errorf("relative link wasn't fingerprinted: '%s' (should contain '%s')", buf, expect)
+	}
+	if buf, err := ioutil.ReadFile(filepath.Join(config.Output, filepath.FromSlash(css))); err != nil {
+		test.Error(err)
+	} else if expect := "url(../img/" + path.Base(png) + ")"; !strings.Contains(string(buf), expect) {
+		test.Errorf("css url wasn't fingerprinted: '%s' (should contain '%s')", buf, expect)
+	}
+
+	if err := os.RemoveAll(tdir); err != nil {
+		test.Error(err)
+	}
+}
+
+// TestBuildSearchIndex isn't parallel, since `build` uses the global `config`.
+func TestBuildSearchIndex(test *testing.T) {
+	tdir := filepath.Join(os.TempDir(), "pagr_test", "TestBuildSearchIndex")
+	files := map[string]string{
+		"content/index.md":       "# home",
+		"content/bad/index.md":   "# bad",
+		"content/bad/meta.json":  `{"template": "broken"}`,
+		"templates/default.tmpl": "{{.Meta.Title}}",
+		"templates/broken.tmpl":  "{{.Missing.Field}}",
+	}
+	for fname, data := range files {
+		fpath := filepath.Join(tdir, fname)
+		if err := os.MkdirAll(filepath.Dir(fpath), 0775); err != nil {
+			test.Fatal("setup failed:", err)
+		}
+		if err := ioutil.WriteFile(fpath, []byte(data), 0644); err != nil {
+			test.Fatal("setup failed:", err)
+		}
+	}
+
+	defer func(cfg Config, w OutputSet) { config, written = cfg, w }(config, written)
+	config = NewConfig()
+	config.relPaths(tdir)
+	config.Staging = false
+	config.Search.Output = "search.json"
+	written = make(OutputSet)
+	build()
+
+	var index SearchIndex
+	if buf, err := ioutil.ReadFile(filepath.Join(config.Output, "search.json")); err != nil {
+		test.Fatal(err)
+	} else if err = json.Unmarshal(buf, &index); err != nil {
+		test.Fatal(err)
+	}
+	if len(index.Pages) != 1 || index.Pages[0].Path != "/" {
+		test.Errorf("search index should only have the page that was built: %+v", index.Pages)
+	}
+
+	if err := os.RemoveAll(tdir); err != nil {
+		test.Error(err)
+	}
+}
+
+// TestFindPageTemplate isn't parallel, since it sets the global `config`.
+func TestFindPageTemplate(test *testing.T) {
+	defer func(cfg Config) { config = cfg }(config)
+	config = NewConfig()
+
+	templates := []suti.Template{{Name: "default"}, {Name: "post.html"}, {Name: "default.json"}}
+	p := NewPage("/blog/a", time.Now())
+	p.Meta["Template"] = "psot"
+	if t, err := findPageTemplate(p, "html", templates); err != nil || t.Name != "default" {
+		test.Errorf("findPageTemplate returned '%s' (%v), should fall back to 'default'", t.Name, err)
+	}
+	config.Strict = true
+	if _, err := findPageTemplate(p, "html", templates); err == nil {
+		test.Error("findPageTemplate didn't fail for a missing Meta template in strict mode")
+	}
+	p.Meta["Template"] = "post"
+	if t, err := findPageTemplate(p, "json", templates); err != nil || t.Name != "default.json" {
+		test.Errorf("findPageTemplate returned '%s' (%v) for json, should be 'default.json'", t.Name, err)
+	}
+}
+
+// TestServePaths isn't parallel, since it sets the global `config`.
+func TestServePaths(test *testing.T) {
+	defer func(cfg Config, fpath string) { config, flagConfig = cfg, fpath }(config, flagConfig)
+	config = NewConfig()
+	config.Assets = []string{"assets", "static"}
+	config.Generators = []Generator{{Source: "data/team.csv"}}
+	config.Bundles = []Bundle{{Files: []string{"js/a.js"}}}
+	flagConfig = "pagr.yaml"
+
+	paths := strings.Join(servePaths(), ",")
+	for _, expect := range []string{config.Templates, config.Contents, "assets", "static", "data/team.csv", "js/a.js", "pagr.yaml"} {
+		if !strings.Contains(paths, expect) {
+			test.Errorf("servePaths doesn't include '%s': %s", expect, paths)
+		}
+	}
+}
+
+// TestParseCommand isn't parallel, since it parses the global flags.
+func TestParseCommand(test *testing.T) {
+	defer func(verbose, strict bool) {
+		flagVerbose, flagStrict = verbose, strict
+	}(flagVerbose, flagStrict)
+
+	flagVerbose, flagStrict = false, false
+	cmd, args := parseCommand([]string{"-v", "build", "-strict", "extra"})
+	if cmd.Name != "build" {
+		test.Errorf("parseCommand returned the command '%s' (should be 'build')", cmd.Name)
+	} else if !flagVerbose || !flagStrict {
+		test.Errorf("parseCommand didn't set the global & command flags (-v %t, -strict %t)", flagVerbose, flagStrict)
+	} else if len(args) != 1 || args[0] != "extra" {
+		test.Errorf("parseCommand returned the args %v (should be [extra])", args)
+	}
+
+	flagVerbose, flagStrict = false, false
+	if cmd, args = parseCommand([]string{}); cmd.Name != "build" || len(args) != 0 {
+		test.Errorf("parseCommand returned '%s' %v (should be the default 'build' command)", cmd.Name, args)
+	} else if flagVerbose || flagStrict {
+		test.Error("parseCommand set flags that weren't given")
+	}
+
+	if cmd, _ = parseCommand([]string{"list"}); cmd.Name != "list" {
+		test.Errorf("parseCommand returned the command '%s' (should be 'list')", cmd.Name)
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// Preprocessor maps asset files with the extension `Ext` to a transformation,
+// the result is written to `Config.Output` with the extension `OutExt`.
+type Preprocessor struct {
+	Ext    string // e.g. ".scss"
+	OutExt string // e.g. ".css"
+	// Command is an external command run to transform each file, the file
+	// is piped to it's stdin and it's stdout is written as the output.
+	// Any "{src}" arguments are replaced with the filepath of the file.
+	// If empty, the builtin preprocessor for `Ext` is used (only ".scss").
+	Command []string
+}
+
+// builtinPreprocessors are the transformations used by Preprocessors
+// without a `Command`, mapped by extension.
+var builtinPreprocessors = map[string]func(fpath string) ([]byte, error){
+	".scss": CompileScss,
+}
+
+// findPreprocessor returns the first Preprocessor in `pps` with an `Ext`
+// matching the extension of `fpath`.
+func findPreprocessor(fpath string, pps []Preprocessor) (Preprocessor, bool) {
+	ext := strings.ToLower(filepath.Ext(fpath))
+	for _, pp := range pps {
+		if "."+strings.TrimPrefix(strings.ToLower(pp.Ext), ".") == ext {
+			return pp, true
+		}
+	}
+	return Preprocessor{}, false
+}
+
+// isPartial returns true for SCSS partials (e.g. "_vars.scss"), which are
+// only imported by other files and not written to the output.
+func (pp Preprocessor) isPartial(fpath string) bool {
+	return len(pp.Command) == 0 && strings.HasPrefix(filepath.Base(fpath), "_")
+}
+
+// OutputPath returns `fpath` with it's extension replaced by `pp.OutExt`.
+func (pp Preprocessor) OutputPath(fpath string) string {
+	if len(pp.OutExt) == 0 {
+		return fpath
+	}
+	return strings.TrimSuffix(fpath, filepath.Ext(fpath)) + "." + strings.TrimPrefix(pp.OutExt, ".")
+}
+
+// Process returns the result of transforming the file at `fpath` with `pp`.
+func (pp Preprocessor) Process(fpath string) (out []byte, err error) {
+	if len(pp.Command) == 0 {
+		builtin, ok := builtinPreprocessors["."+strings.TrimPrefix(strings.ToLower(pp.Ext), ".")]
+		if !ok {
+			return nil, fmt.Errorf("no builtin preprocessor for '%s', a Command is required", pp.Ext)
+		}
+		return builtin(fpath)
+	}
+
+	var in *os.File
+	if in, err = os.Open(fpath); err != nil {
+		return
+	}
+	defer in.Close()
+
+	args := make([]string, len(pp.Command)-1)
+	for i, a := range pp.Command[1:] {
+		args[i] = strings.Replace(a, "{src}", fpath, -1)
+	}
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(pp.Command[0], args...)
+	cmd.Stdin = in
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err = cmd.Run(); err != nil {
+		err = fmt.Errorf("%s: %s: %s", pp.Command[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.Bytes(), err
+}
+
+// preprocessAsset transforms the asset file at `src` with `pp` and writes it
+// to `outDir` at the URL path `url` (with `pp.OutExt`). The written URL path
+// is returned. If `fingerprint` is true the output is fingerprinted and
+// added to `manifest`. If `minify` is set, the output is minified as that type.
+func preprocessAsset(pp Preprocessor, src, url, outDir, minify string, fingerprint bool) (string, error) {
+	out, err := pp.Process(src)
+	if err != nil {
+		return url, err
+	}
+	if len(minify) > 0 {
+		if out, err = Minify(out, minify); err != nil {
+			return url, err
+		}
+	}
+
+	url = pp.OutputPath(url)
+	if fingerprint {
+		sum := sha256.Sum256(out)
+		url = manifest.Add(url, hex.EncodeToString(sum[:]))
+	}
+	dst := filepath.Join(outDir, url)
+	if err = os.MkdirAll(filepath.Dir(dst), 0755); err == nil {
+		err = replaceFile(dst, out, 0644)
+	}
+	return url, err
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPreprocessAsset(test *testing.T) {
+	test.Parallel()
+
+	tdir := filepath.Join(os.TempDir(), "pagr_test", "TestPreprocessAsset")
+	if err := os.MkdirAll(tdir, 0775); err != nil {
+		test.Errorf("failed to create temporary test dir: %s", tdir)
+	}
+
+	src := filepath.Join(tdir, "style.scss")
+	if err := ioutil.WriteFile(src, []byte("$c: red;\nb { i { color: $c; } }\n"), 0644); err != nil {
+		test.Error("setup failed:", err)
+	}
+	pps := []Preprocessor{{Ext: "scss", OutExt: ".css"}, {Ext: ".txt", OutExt: "upper", Command: []string{"tr", "a-z", "A-Z"}}}
+
+	pp, ok := findPreprocessor(src, pps)
+	if !ok {
+		test.Fatal("findPreprocessor did not find the scss preprocessor")
+	}
+	outDir := filepath.Join(tdir, "out")
+	url, err := preprocessAsset(pp, src, "/css/style.scss", outDir, "css", false)
+	if err != nil {
+		test.Fatal(err)
+	} else if url != "/css/style.css" {
+		test.Errorf("preprocessAsset returned '%s'", url)
+	}
+	if buf, err := ioutil.ReadFile(filepath.Join(outDir, "css", "style.css")); err != nil {
+		test.Error(err)
+	} else if string(buf) != "b i{color:red}" {
+		test.Errorf("invalid output written: '%s'", buf)
+	}
+
+	src = filepath.Join(tdir, "a.txt")
+	if err = ioutil.WriteFile(src, []byte("hello"), 0644); err != nil {
+		test.Error("setup failed:", err)
+	}
+	if pp, ok = findPreprocessor(src, pps); !ok {
+		test.Fatal("findPreprocessor did not find the txt preprocessor")
+	}
+	if out, err := pp.Process(src); err != nil {
+		test.Error(err)
+	} else if string(out) != "HELLO" {
+		test.Errorf("Process returned '%s'", out)
+	}
+
+	if _, ok = findPreprocessor("a.md", pps); ok {
+		test.Error("findPreprocessor found a preprocessor for 'a.md'")
+	}
+
+	if err = os.RemoveAll(tdir); err != nil {
+		test.Error(err)
+	}
+}
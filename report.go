@@ -0,0 +1,126 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Exit codes returned by pagr when a build report is requested (-report).
+const (
+	ExitOK       = 0 // the build succeeded
+	ExitError    = 1 // the build failed
+	ExitWarnings = 2 // the build succeeded, with warnings
+)
+
+// PageReport is the report of a single page output written in a build.
+type PageReport struct {
+	Path     string   `json:"path"`
+	Sources  []string `json:"sources"`
+	Template string   `json:"template"`
+	Format   string   `json:"format"`
+	Output   string   `json:"output"` // relative to the output directory
+	Bytes    int64    `json:"bytes"`
+	RenderMs float64  `json:"renderMs"`
+}
+
+// AssetReport is the report of a single asset file written in a build.
+type AssetReport struct {
+	Source string `json:"source"`
+	Output string `json:"output"` // relative to the output directory
+	Bytes  int64  `json:"bytes"`
+}
+
+// BuildReport is a machine-readable report of everything done in a build.
+type BuildReport struct {
+	Success  bool          `json:"success"`
+	Started  time.Time     `json:"started"`
+	Duration float64       `json:"durationMs"`
+	Pages    []PageReport  `json:"pages"`
+	Assets   []AssetReport `json:"assets"`
+	Warnings []string      `json:"warnings"`
+	Errors   []string      `json:"errors"`
+}
+
+// report is the BuildReport of the current build.
+var report = NewBuildReport()
+
+// NewBuildReport returns an empty BuildReport, started now.
+func NewBuildReport() *BuildReport {
+	return &BuildReport{
+		Started:  time.Now(),
+		Pages:    []PageReport{},
+		Assets:   []AssetReport{},
+		Warnings: []string{},
+		Errors:   []string{},
+	}
+}
+
+func relOutput(outDir, fpath string) string {
+	if rel, err := filepath.Rel(outDir, fpath); err == nil {
+		return filepath.ToSlash(rel)
+	}
+	return fpath
+}
+
+// AddPage adds the output of page `p` written to `out` (in `outDir`) to `r`.
+func (r *BuildReport) AddPage(p Page, format, template, outDir, out string, render time.Duration) {
+	r.Pages = append(r.Pages, PageReport{
+		Path:     p.Path,
+		Sources:  p.sources,
+		Template: template,
+		Format:   format,
+		Output:   relOutput(outDir, out),
+		RenderMs: float64(render) / float64(time.Millisecond),
+	})
+}
+
+// AddAsset adds the file `src` written to the URL path `url` to `r`.
+func (r *BuildReport) AddAsset(src, url string) {
+	r.Assets = append(r.Assets, AssetReport{Source: src, Output: strings.TrimPrefix(path.Clean("/"+filepath.ToSlash(url)), "/")})
+}
+
+// Warn adds the warning `msg` to `r`.
+func (r *BuildReport) Warn(msg string) {
+	r.Warnings = append(r.Warnings, msg)
+}
+
+// Error adds the error `err` to `r`.
+func (r *BuildReport) Error(err error) {
+	r.Errors = append(r.Errors, err.Error())
+}
+
+// ExitCode returns the exit code for the build reported in `r`.
+func (r *BuildReport) ExitCode() int {
+	if len(r.Errors) > 0 {
+		return ExitError
+	} else if len(r.Warnings) > 0 {
+		return ExitWarnings
+	}
+	return ExitOK
+}
+
+// Write sets the size of each file in `r` (found in `outDir`) and the build
+// duration, then writes `r` as JSON to `w`.
+func (r *BuildReport) Write(w io.Writer, outDir string) error {
+	r.Success = len(r.Errors) == 0
+	r.Duration = float64(time.Since(r.Started)) / float64(time.Millisecond)
+	for i, p := range r.Pages {
+		if info, err := os.Stat(filepath.Join(outDir, filepath.FromSlash(p.Output))); err == nil {
+			r.Pages[i].Bytes = info.Size()
+		}
+	}
+	for i, a := range r.Assets {
+		if info, err := os.Stat(filepath.Join(outDir, filepath.FromSlash(a.Output))); err == nil {
+			r.Assets[i].Bytes = info.Size()
+		}
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "\t")
+	return enc.Encode(r)
+}
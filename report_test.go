@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestBuildReport(test *testing.T) {
+	test.Parallel()
+
+	tdir := filepath.Join(os.TempDir(), "pagr_test", "TestBuildReport")
+	if err := os.MkdirAll(filepath.Join(tdir, "a"), 0775); err != nil {
+		test.Errorf("failed to create temporary test dir: %s", tdir)
+	}
+	if err := ioutil.WriteFile(filepath.Join(tdir, "a", "index.html"), []byte("<p>a</p>"), 0644); err != nil {
+		test.Error("setup failed:", err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(tdir, "a.css"), []byte("a{}"), 0644); err != nil {
+		test.Error("setup failed:", err)
+	}
+
+	r := NewBuildReport()
+	if code := r.ExitCode(); code != ExitOK {
+		test.Errorf("ExitCode returned %d for an empty report", code)
+	}
+	r.AddPage(Page{Path: "/a", sources: []string{"content/a/body.md"}}, "html", "default", tdir,
+		filepath.Join(tdir, "a", "index.html"), time.Millisecond)
+	r.AddAsset("assets/a.css", "/a.css")
+	r.Warn("skipping /b")
+	if code := r.ExitCode(); code != ExitWarnings {
+		test.Errorf("ExitCode returned %d for a report with warnings", code)
+	}
+
+	var buf bytes.Buffer
+	if err := r.Write(&buf, tdir); err != nil {
+		test.Fatal(err)
+	}
+	var decoded BuildReport
+	if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil {
+		test.Fatal(err)
+	}
+	if !decoded.Success || len(decoded.Pages) != 1 || len(decoded.Assets) != 1 || len(decoded.Warnings) != 1 {
+		test.Fatalf("invalid report written: %s", buf.String())
+	}
+	if p := decoded.Pages[0]; p.Output != "a/index.html" || p.Bytes != 8 || p.Template != "default" || p.RenderMs != 1 {
+		test.Errorf("invalid page report: %+v", p)
+	}
+	if a := decoded.Assets[0]; a.Output != "a.css" || a.Bytes != 3 {
+		test.Errorf("invalid asset report: %+v", a)
+	}
+
+	r.Error(errors.New("failed"))
+	if code := r.ExitCode(); code != ExitError {
+		test.Errorf("ExitCode returned %d for a report with errors", code)
+	}
+
+	if err := os.RemoveAll(tdir); err != nil {
+		test.Error(err)
+	}
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	tmpl "text/template"
+	"time"
+)
+
+// Archetype is the data that archetype files are executed with, when they're
+// used to create a new page (see `NewContentPage`).
+type Archetype struct {
+	Path    string
+	Section string
+	Slug    string
+	Title   string
+	Date    string
+	Draft   bool
+}
+
+// archetypeMeta is the source of the "meta" file of the default archetype,
+// for each data format.
+var archetypeMeta = map[string]string{
+	"json": "{\n\t\"Title\": {{printf \"%q\" .Title}},\n\t\"Date\": \"{{.Date}}\",\n\t\"Draft\": {{.Draft}}\n}\n",
+	"yaml": "Title: {{printf \"%q\" .Title}}\nDate: \"{{.Date}}\"\nDraft: {{.Draft}}\n",
+	"toml": "Title = {{printf \"%q\" .Title}}\nDate = \"{{.Date}}\"\nDraft = {{.Draft}}\n",
+}
+
+// newSiteConfig is the config file of a new project, for each data format.
+var newSiteConfig = map[string]string{
+	"json": "{\n\t\"Contents\": \"./content\",\n\t\"Templates\": \"./templates\",\n\t\"Assets\": [\"./assets\"],\n\t\"Output\": \"./out\",\n\t\"Archetypes\": \"./archetypes\",\n\t\"DefaultTemplate\": \"default\"\n}\n",
+	"yaml": "Contents: ./content\nTemplates: ./templates\nAssets:\n  - ./assets\nOutput: ./out\nArchetypes: ./archetypes\nDefaultTemplate: default\n",
+	"toml": "Contents = \"./content\"\nTemplates = \"./templates\"\nAssets = [\"./assets\"]\nOutput = \"./out\"\nArchetypes = \"./archetypes\"\nDefaultTemplate = \"default\"\n",
+}
+
+// defaultArchetype returns the files of the archetype used when a project
+// doesn't have one, with a "meta" file in the data `format`.
+func defaultArchetype(format string) (map[string]string, error) {
+	if format == "yml" {
+		format = "yaml"
+	}
+	meta, ok := archetypeMeta[format]
+	if !ok {
+		return nil, fmt.Errorf("unsupported data format '%s' (should be json, yaml or toml)", format)
+	}
+	return map[string]string{
+		"meta." + format: meta,
+		"index.md":       "Write the content of {{.Title}} here.\n",
+	}, nil
+}
+
+// findArchetype returns the files of the archetype for the page `p`, the
+// directory named by `p.Section()` or "default" in the last of
+// `archetypeDirs` that has one. If none is found, `defaultArchetype` is
+// returned. The files are mapped by their path relative to the archetype.
+func findArchetype(p Page, archetypeDirs []string, format string) (files map[string]string, err error) {
+	for _, name := range []string{p.Section(), "default"} {
+		if len(name) == 0 {
+			continue
+		}
+		for i := len(archetypeDirs) - 1; i >= 0; i-- {
+			dir := filepath.Join(archetypeDirs[i], name)
+			if info, e := os.Stat(dir); e != nil || !info.IsDir() {
+				continue
+			}
+			var paths map[string]string
+			var rels []string
+			if paths, rels, err = overlayFiles([]string{dir}); err != nil {
+				return
+			}
+			files = make(map[string]string)
+			for _, rel := range rels {
+				var buf []byte
+				if buf, err = ioutil.ReadFile(paths[rel]); err != nil {
+					return
+				}
+				files[rel] = string(buf)
+			}
+			return
+		}
+	}
+	return defaultArchetype(format)
+}
+
+// NewContentPage creates the page `ppath` (e.g. "blog/my-post") as a
+// directory in `contentsDir`, from the archetype found in `archetypeDirs`
+// for it (see `findArchetype`). Each archetype file is executed as a "tmpl"
+// template with an `Archetype` (the page Title is set from `ppath`, Date is
+// set to `now` and Draft to true, so it isn't built until Draft is removed
+// or `config.Drafts` is set). The paths of the created files are returned.
+func NewContentPage(contentsDir, ppath string, archetypeDirs []string, format string, now time.Time) (created []string, err error) {
+	clean := path.Clean("/" + filepath.ToSlash(ppath))
+	if clean == "/" {
+		return nil, fmt.Errorf("invalid page path '%s'", ppath)
+	}
+	ppath = clean
+	dir := filepath.Join(contentsDir, filepath.FromSlash(ppath))
+	if _, err = os.Stat(dir); err == nil {
+		return nil, fmt.Errorf("%s already exists", dir)
+	}
+
+	p := NewPage(ppath, now)
+	data := Archetype{
+		Path:    p.Path,
+		Section: p.Section(),
+		Slug:    p.Slug,
+		Title:   fmt.Sprint(p.Meta["Title"]),
+		Date:    now.Format(timefmt),
+		Draft:   true,
+	}
+
+	var files map[string]string
+	if files, err = findArchetype(p, archetypeDirs, format); err != nil {
+		return
+	}
+	for rel, src := range files {
+		var t *tmpl.Template
+		if t, err = tmpl.New(rel).Funcs(templateFuncs).Parse(src); err != nil {
+			return created, fmt.Errorf("archetype %s: %s", rel, err)
+		}
+		var buf bytes.Buffer
+		if err = t.Execute(&buf, data); err != nil {
+			return created, fmt.Errorf("archetype %s: %s", rel, err)
+		}
+		fpath := filepath.Join(dir, rel)
+		if err = writeNewFile(fpath, buf.Bytes()); err != nil {
+			return
+		}
+		created = append(created, fpath)
+	}
+	return
+}
+
+// newSiteFiles are the files created in a new project by `NewSite`, other
+// than the config file and archetype.
+var newSiteFiles = map[string]string{
+	"templates/default.hmpl": `<!DOCTYPE html>
+<html>
+<head>
+	<meta charset="utf-8">
+	<meta name="viewport" content="width=device-width, initial-scale=1">
+	<title>{{.Meta.Title}}</title>
+	<link rel="stylesheet" href="{{asset "/style.css"}}">
+</head>
+<body>
+	<header><a href="{{relURL "/"}}">Home</a></header>
+	<main>
+		<h1>{{.Meta.Title}}</h1>
+		{{range .Contents}}{{printf "%s" . | safeHTML}}{{end}}
+	</main>
+</body>
+</html>
+`,
+	"content/index.md": "Welcome to your new site, built with [pagr](https://notabug.org/gearsix/pagr).\n\n" +
+		"- Pages are directories in `content/`, with content files (markdown, HTML or text) & a \"meta\" data file.\n" +
+		"- Templates are in `templates/`, assets in `assets/`.\n" +
+		"- Create new pages with `pagr new page <path>`.\n",
+	"assets/style.css": "body {\n\tmax-width: 40em;\n\tmargin: 2em auto;\n\tfont-family: sans-serif;\n}\n",
+}
+
+// NewSite creates a new project in `dir`, which must be empty or not
+// exist. The project has a config file ("pagr.`format`", in the data
+// `format`), a default template, sample content, a stylesheet and a default
+// archetype. The paths of the created files are returned.
+func NewSite(dir, format string) (created []string, err error) {
+	if entries, e := ioutil.ReadDir(dir); e == nil && len(entries) > 0 {
+		return nil, fmt.Errorf("%s already exists and is not empty", dir)
+	}
+	if format == "yml" {
+		format = "yaml"
+	}
+	var archetype map[string]string
+	if archetype, err = defaultArchetype(format); err != nil {
+		return
+	}
+
+	files := make(map[string]string)
+	for rel, src := range newSiteFiles {
+		files[rel] = src
+	}
+	for rel, src := range archetype {
+		files[path.Join("archetypes", "default", rel)] = src
+	}
+
+	files[Name+"."+format] = newSiteConfig[format]
+
+	for rel, src := range files {
+		fpath := filepath.Join(dir, filepath.FromSlash(rel))
+		if err = writeNewFile(fpath, []byte(src)); err != nil {
+			return
+		}
+		created = append(created, fpath)
+	}
+	return
+}
+
+// writeNewFile writes `data` to the file `fpath` (creating it's parent
+// directories), failing if it already exists.
+func writeNewFile(fpath string, data []byte) (err error) {
+	if err = os.MkdirAll(filepath.Dir(fpath), 0755); err != nil {
+		return
+	}
+	var f *os.File
+	if f, err = os.OpenFile(fpath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644); err != nil {
+		return
+	}
+	_, err = f.Write(data)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return
+}
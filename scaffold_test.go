@@ -0,0 +1,111 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"notabug.org/gearsix/suti"
+)
+
+func TestNewSite(test *testing.T) {
+	test.Parallel()
+
+	tdir := filepath.Join(os.TempDir(), "pagr_test", "TestNewSite")
+	os.RemoveAll(tdir)
+
+	if _, err := NewSite(tdir, "xml"); err == nil {
+		test.Error("NewSite didn't fail for an unsupported format")
+	}
+	created, err := NewSite(tdir, "json")
+	if err != nil {
+		test.Fatal(err)
+	} else if len(created) != len(newSiteFiles)+3 { // + config, archetype meta & index
+		test.Errorf("NewSite created %d files (should be %d)", len(created), len(newSiteFiles)+3)
+	}
+	if _, err = NewSite(tdir, "json"); err == nil {
+		test.Error("NewSite didn't fail for an existing directory")
+	}
+
+	cfg, err := NewConfigFromFile(filepath.Join(tdir, Name+".json"))
+	if err != nil {
+		test.Fatal(err)
+	} else if cfg.Contents != filepath.Join(tdir, "content") || cfg.Archetypes != filepath.Join(tdir, "archetypes") {
+		test.Fatalf("invalid config: %+v", cfg)
+	}
+	if _, err = LoadTemplateDir(cfg.Templates); err != nil {
+		test.Error(err)
+	}
+
+	// the config of each format is loaded, with non-default values
+	for _, format := range []string{"yaml", "toml"} {
+		dir := filepath.Join(tdir, format)
+		if _, err = NewSite(dir, format); err != nil {
+			test.Fatal(err)
+		}
+		cfgp := filepath.Join(dir, Name+"."+format)
+		var buf []byte
+		if buf, err = ioutil.ReadFile(cfgp); err != nil {
+			test.Fatal(err)
+		}
+		buf = []byte(strings.Replace(string(buf), "./out", "./public", 1))
+		if err = ioutil.WriteFile(cfgp, buf, 0644); err != nil {
+			test.Fatal("setup failed:", err)
+		}
+		if c, err := NewConfigFromFile(cfgp); err != nil {
+			test.Error(err)
+		} else if c.Output != filepath.Join(dir, "public") || c.Contents != filepath.Join(dir, "content") ||
+			len(c.Assets) != 1 || c.Assets[0] != filepath.Join(dir, "assets") || c.DefaultTemplate != "default" {
+			test.Errorf("invalid %s config: %+v", format, c)
+		}
+	}
+
+	// section archetype
+	blog := filepath.Join(cfg.Archetypes, "blog")
+	if err = os.MkdirAll(blog, 0775); err != nil {
+		test.Fatal("setup failed:", err)
+	}
+	if err = ioutil.WriteFile(filepath.Join(blog, "post.md"), []byte("# {{.Title}} ({{.Section}})\n"), 0644); err != nil {
+		test.Fatal("setup failed:", err)
+	}
+
+	now := time.Date(2021, 3, 4, 0, 0, 0, 0, time.UTC)
+	archetypes := []string{filepath.Join(tdir, "missing"), cfg.Archetypes}
+	if created, err = NewContentPage(cfg.Contents, "docs/getting-started", archetypes, "json", now); err != nil {
+		test.Fatal(err)
+	} else if len(created) != 2 {
+		test.Fatalf("NewContentPage created %d files (should be 2): %v", len(created), created)
+	}
+	var meta Meta
+	if err = suti.LoadDataFilepath(filepath.Join(cfg.Contents, "docs", "getting-started", "meta.json"), &meta); err != nil {
+		test.Fatal(err)
+	}
+	if meta["Title"] != "Getting Started" || meta["Date"] != "2021-03-04" || meta["Draft"] != true {
+		test.Errorf("invalid page meta: %v", meta)
+	}
+
+	if created, err = NewContentPage(cfg.Contents, "/blog/hello-world/", archetypes, "json", now); err != nil {
+		test.Fatal(err)
+	} else if len(created) != 1 {
+		test.Fatalf("NewContentPage created %d files (should be 1): %v", len(created), created)
+	}
+	if buf, err := ioutil.ReadFile(created[0]); err != nil {
+		test.Fatal(err)
+	} else if string(buf) != "# Hello World (blog)\n" {
+		test.Errorf("invalid section archetype output: '%s'", buf)
+	}
+
+	if _, err = NewContentPage(cfg.Contents, "blog/hello-world", archetypes, "json", now); err == nil {
+		test.Error("NewContentPage didn't fail for an existing page")
+	}
+	if _, err = NewContentPage(cfg.Contents, "/", archetypes, "json", now); err == nil {
+		test.Error("NewContentPage didn't fail for the root page")
+	}
+
+	if err = os.RemoveAll(tdir); err != nil {
+		test.Error(err)
+	}
+}
@@ -0,0 +1,457 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// scss.go is a compiler for a subset of SCSS, supporting:
+// - "//" and "/* */" comments
+// - variables ("$name: value;", with "!default"), scoped to their block
+// - "#{...}" interpolation
+// - nested rules, nested at-rules (e.g. @media) and "&" parent selectors
+// - @import of other SCSS files (and "_" prefixed partials)
+// - @mixin (with optional arguments & default values) and @include
+// Anything else (functions, math, @extend, control directives) is not supported.
+
+type scssItemKind int
+
+const (
+	scssDecl scssItemKind = iota
+	scssVar
+	scssStatement // at-rule without a block, e.g. "@charset"
+	scssInclude
+	scssRule
+	scssAtRule
+	scssMixin
+)
+
+type scssItem struct {
+	kind     scssItemKind
+	text     string // declaration, selector, at-rule prelude, etc
+	children []scssItem
+}
+
+type scssScope struct {
+	vars   map[string]string
+	mixins map[string]scssItem
+	parent *scssScope
+}
+
+func newScssScope(parent *scssScope) *scssScope {
+	return &scssScope{vars: make(map[string]string), mixins: make(map[string]scssItem), parent: parent}
+}
+
+func (s *scssScope) lookup(name string) (string, bool) {
+	for ; s != nil; s = s.parent {
+		if v, ok := s.vars[name]; ok {
+			return v, true
+		}
+	}
+	return "", false
+}
+
+func (s *scssScope) mixin(name string) (scssItem, bool) {
+	for ; s != nil; s = s.parent {
+		if m, ok := s.mixins[name]; ok {
+			return m, true
+		}
+	}
+	return scssItem{}, false
+}
+
+var scssVarRegexp = regexp.MustCompile(`\$[A-Za-z_][A-Za-z0-9_-]*`)
+var scssInterpRegexp = regexp.MustCompile(`#\{([^}]*)\}`)
+
+// eval returns `value` with all interpolations & variables substituted.
+func (s *scssScope) eval(value string) (string, error) {
+	var err error
+	replace := func(name string) string {
+		v, ok := s.lookup(name[1:])
+		if !ok && err == nil {
+			err = fmt.Errorf("undefined variable %s", name)
+		}
+		return v
+	}
+	value = scssInterpRegexp.ReplaceAllStringFunc(value, func(match string) string {
+		return scssVarRegexp.ReplaceAllStringFunc(match[2:len(match)-1], replace)
+	})
+	return strings.TrimSpace(scssVarRegexp.ReplaceAllStringFunc(value, replace)), err
+}
+
+// stripScssComments removes "/* */" comments and "//" line comments from
+// `src`. A "//" is only treated as a comment when it's at the start of a
+// line or after whitespace, so URLs (e.g. "url(//cdn.com/x)") are kept.
+func stripScssComments(src string) string {
+	var out strings.Builder
+	var quote byte
+	for i := 0; i < len(src); i++ {
+		c := src[i]
+		switch {
+		case quote != 0:
+			if c == '\\' && i+1 < len(src) {
+				out.WriteByte(c)
+				i++
+				c = src[i]
+			} else if c == quote || c == '\n' {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '/' && i+1 < len(src) && src[i+1] == '*':
+			end := strings.Index(src[i+2:], "*/")
+			if end == -1 {
+				return out.String()
+			}
+			out.WriteString(strings.Repeat("\n", strings.Count(src[i:i+end+2], "\n")))
+			i += end + 3
+			continue
+		case c == '/' && i+1 < len(src) && src[i+1] == '/' &&
+			(i == 0 || strings.IndexByte(" \t\n\r;{}", src[i-1]) != -1):
+			for i < len(src) && src[i] != '\n' {
+				i++
+			}
+			if i < len(src) {
+				out.WriteByte('\n')
+			}
+			continue
+		}
+		out.WriteByte(c)
+	}
+	return out.String()
+}
+
+type scssParser struct {
+	src     string
+	pos     int
+	path    string   // filepath of the file being parsed
+	imports []string // filepaths of the files importing `path`, outermost first
+}
+
+func (p *scssParser) errorf(format string, args ...interface{}) error {
+	line := strings.Count(p.src[:p.pos], "\n") + 1
+	return fmt.Errorf("%s:%d: %s", p.path, line, fmt.Sprintf(format, args...))
+}
+
+// next reads the source up to (not including) the next ';', '{' or '}'
+// that's not inside quotes, parentheses or an interpolation.
+func (p *scssParser) next() (text string, end byte) {
+	var quote byte
+	depth := 0
+	start := p.pos
+	for ; p.pos < len(p.src); p.pos++ {
+		c := p.src[p.pos]
+		if quote != 0 {
+			if c == '\\' {
+				p.pos++
+			} else if c == quote {
+				quote = 0
+			}
+			continue
+		}
+		switch c {
+		case '"', '\'':
+			quote = c
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case '#':
+			if p.pos+1 < len(p.src) && p.src[p.pos+1] == '{' {
+				if i := strings.IndexByte(p.src[p.pos:], '}'); i != -1 {
+					p.pos += i
+				}
+			}
+		case ';', '{', '}':
+			if depth <= 0 {
+				text = strings.TrimSpace(p.src[start:p.pos])
+				end = c
+				p.pos++
+				return
+			}
+		}
+	}
+	return strings.TrimSpace(p.src[start:]), 0
+}
+
+func (p *scssParser) parseBlock(nested bool) (items []scssItem, err error) {
+	for {
+		text, end := p.next()
+		switch end {
+		case 0:
+			if nested {
+				err = p.errorf("unexpected end of file, missing '}'")
+			} else if len(text) > 0 {
+				items = append(items, p.statement(text))
+			}
+			return
+		case '}':
+			if !nested {
+				err = p.errorf("unexpected '}'")
+				return
+			}
+			if len(text) > 0 {
+				items = append(items, p.statement(text))
+			}
+			return
+		case ';':
+			if len(text) == 0 {
+				continue
+			}
+			if strings.HasPrefix(text, "@import") {
+				var imported []scssItem
+				if imported, err = p.importFiles(strings.TrimSpace(text[7:])); err != nil {
+					return
+				}
+				items = append(items, imported...)
+			} else {
+				items = append(items, p.statement(text))
+			}
+		case '{':
+			item := scssItem{kind: scssRule, text: text}
+			if strings.HasPrefix(text, "@mixin") {
+				item.kind = scssMixin
+				item.text = strings.TrimSpace(text[6:])
+				name, params := splitArgs(item.text)
+				for _, param := range params {
+					if pname := strings.TrimSpace(strings.SplitN(param, ":", 2)[0]); len(pname) < 2 || pname[0] != '$' {
+						err = p.errorf("invalid parameter '%s' for mixin '%s'", param, name)
+						return
+					}
+				}
+			} else if strings.HasPrefix(text, "@") {
+				item.kind = scssAtRule
+			}
+			if item.children, err = p.parseBlock(true); err != nil {
+				return
+			}
+			items = append(items, item)
+		}
+	}
+}
+
+func (p *scssParser) statement(text string) scssItem {
+	switch {
+	case strings.HasPrefix(text, "$"):
+		return scssItem{kind: scssVar, text: text}
+	case strings.HasPrefix(text, "@include"):
+		return scssItem{kind: scssInclude, text: strings.TrimSpace(text[8:])}
+	case strings.HasPrefix(text, "@"):
+		return scssItem{kind: scssStatement, text: text}
+	}
+	return scssItem{kind: scssDecl, text: text}
+}
+
+// importFiles parses the files listed in the arguments of an @import.
+// Imports of plain CSS files and URLs are kept as @import statements.
+func (p *scssParser) importFiles(args string) (items []scssItem, err error) {
+	for _, arg := range strings.Split(args, ",") {
+		name := strings.Trim(strings.TrimSpace(arg), `"'`)
+		if strings.HasSuffix(name, ".css") || strings.HasPrefix(name, "url(") || strings.Contains(name, "://") {
+			items = append(items, scssItem{kind: scssStatement, text: "@import " + strings.TrimSpace(arg)})
+			continue
+		}
+
+		dir, base := filepath.Split(filepath.Join(filepath.Dir(p.path), filepath.FromSlash(name)))
+		var found string
+		for _, candidate := range []string{base, base + ".scss", "_" + base, "_" + base + ".scss"} {
+			if info, e := os.Stat(filepath.Join(dir, candidate)); e == nil && !info.IsDir() {
+				found = filepath.Join(dir, candidate)
+				break
+			}
+		}
+		if len(found) == 0 {
+			return nil, p.errorf("cannot find import '%s'", name)
+		}
+		stack := append(append([]string{}, p.imports...), filepath.Clean(p.path))
+		for i, fpath := range stack {
+			if fpath == filepath.Clean(found) {
+				return nil, p.errorf("import cycle: %s -> %s", strings.Join(stack[i:], " -> "), found)
+			}
+		}
+
+		var imported []scssItem
+		if imported, err = parseScssFile(found, stack); err != nil {
+			return
+		}
+		items = append(items, imported...)
+	}
+	return
+}
+
+// parseScssFile parses the file at `fpath`, which is imported by the files
+// in `imports` (see `scssParser.imports`).
+func parseScssFile(fpath string, imports []string) ([]scssItem, error) {
+	buf, err := ioutil.ReadFile(fpath)
+	if err != nil {
+		return nil, err
+	}
+	p := scssParser{src: stripScssComments(string(buf)), path: fpath, imports: imports}
+	return p.parseBlock(false)
+}
+
+// combineSelectors returns the selectors in `selector` nested in each of
+// the `parents` selectors, "&" is replaced by the parent selector.
+func combineSelectors(parents []string, selector string) (combined []string) {
+	for _, s := range strings.Split(selector, ",") {
+		s = strings.Join(strings.Fields(s), " ")
+		if len(parents) == 0 {
+			combined = append(combined, strings.Replace(s, "&", "", -1))
+		}
+		for _, p := range parents {
+			if strings.Contains(s, "&") {
+				combined = append(combined, strings.Replace(s, "&", p, -1))
+			} else {
+				combined = append(combined, p+" "+s)
+			}
+		}
+	}
+	return
+}
+
+// splitArgs splits "name(a, b)" into "name" and ["a", "b"].
+func splitArgs(text string) (name string, args []string) {
+	name = text
+	if i := strings.IndexByte(text, '('); i != -1 && strings.HasSuffix(text, ")") {
+		name = text[:i]
+		for _, a := range strings.Split(text[i+1:len(text)-1], ",") {
+			if a = strings.TrimSpace(a); len(a) > 0 {
+				args = append(args, a)
+			}
+		}
+	}
+	return strings.TrimSpace(name), args
+}
+
+type scssCompiler struct {
+	out strings.Builder
+}
+
+// block compiles `items` nested in the `parents` selectors, writing any
+// declarations to `decls` and nested rules to `c.out`.
+func (c *scssCompiler) block(items []scssItem, parents []string, scope *scssScope, decls *[]string) (err error) {
+	for _, item := range items {
+		switch item.kind {
+		case scssVar:
+			kv := strings.SplitN(item.text, ":", 2)
+			if len(kv) != 2 {
+				return fmt.Errorf("invalid variable '%s'", item.text)
+			}
+			name, value := strings.TrimSpace(kv[0][1:]), strings.TrimSpace(kv[1])
+			if strings.HasSuffix(value, "!default") {
+				if _, ok := scope.lookup(name); ok {
+					continue
+				}
+				value = strings.TrimSpace(strings.TrimSuffix(value, "!default"))
+			}
+			if scope.vars[name], err = scope.eval(value); err != nil {
+				return
+			}
+		case scssDecl:
+			var decl string
+			if decl, err = scope.eval(item.text); err != nil {
+				return
+			}
+			*decls = append(*decls, decl)
+		case scssStatement:
+			c.out.WriteString(item.text + ";\n")
+		case scssMixin:
+			name, _ := splitArgs(item.text)
+			scope.mixins[name] = item
+		case scssInclude:
+			name, args := splitArgs(item.text)
+			mixin, ok := scope.mixin(name)
+			if !ok {
+				return fmt.Errorf("undefined mixin '%s'", name)
+			}
+			mscope := newScssScope(scope)
+			_, params := splitArgs(mixin.text)
+			for i, param := range params {
+				kv := strings.SplitN(param, ":", 2)
+				pname := strings.TrimSpace(kv[0])[1:]
+				if i < len(args) {
+					mscope.vars[pname], err = scope.eval(args[i])
+				} else if len(kv) == 2 {
+					mscope.vars[pname], err = scope.eval(kv[1])
+				} else {
+					err = fmt.Errorf("missing argument $%s for mixin '%s'", pname, name)
+				}
+				if err != nil {
+					return
+				}
+			}
+			if err = c.block(mixin.children, parents, mscope, decls); err != nil {
+				return
+			}
+		case scssRule:
+			var selector string
+			if selector, err = scope.eval(item.text); err != nil {
+				return
+			}
+			if err = c.rule(item.children, combineSelectors(parents, selector), scope); err != nil {
+				return
+			}
+		case scssAtRule:
+			var prelude string
+			if prelude, err = scope.eval(item.text); err != nil {
+				return
+			}
+			c.out.WriteString(prelude + " {\n")
+			if len(parents) > 0 {
+				err = c.rule(item.children, parents, scope)
+			} else {
+				var atdecls []string
+				if err = c.block(item.children, nil, newScssScope(scope), &atdecls); err == nil {
+					for _, d := range atdecls {
+						c.out.WriteString("\t" + d + ";\n")
+					}
+				}
+			}
+			if err != nil {
+				return
+			}
+			c.out.WriteString("}\n")
+		}
+	}
+	return
+}
+
+// rule compiles the rule for `selectors` with the content `items`.
+func (c *scssCompiler) rule(items []scssItem, selectors []string, scope *scssScope) error {
+	var decls []string
+	nested := scssCompiler{}
+	if err := nested.block(items, selectors, newScssScope(scope), &decls); err != nil {
+		return err
+	}
+	if len(decls) > 0 {
+		c.out.WriteString(strings.Join(selectors, ", ") + " {\n")
+		for _, d := range decls {
+			c.out.WriteString("\t" + d + ";\n")
+		}
+		c.out.WriteString("}\n")
+	}
+	c.out.WriteString(nested.out.String())
+	return nil
+}
+
+// CompileScss compiles the SCSS file at `fpath` to CSS.
+func CompileScss(fpath string) (css []byte, err error) {
+	var items []scssItem
+	if items, err = parseScssFile(fpath, nil); err != nil {
+		return
+	}
+
+	var c scssCompiler
+	var decls []string
+	if err = c.block(items, nil, newScssScope(nil), &decls); err != nil {
+		err = fmt.Errorf("%s: %s", fpath, err)
+	} else if len(decls) > 0 {
+		err = fmt.Errorf("%s: declaration '%s' is not inside a rule", fpath, decls[0])
+	}
+	css = []byte(c.out.String())
+	return
+}
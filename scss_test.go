@@ -0,0 +1,101 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCompileScss(test *testing.T) {
+	test.Parallel()
+
+	tdir := filepath.Join(os.TempDir(), "pagr_test", "TestCompileScss")
+	if err := os.MkdirAll(tdir, 0775); err != nil {
+		test.Errorf("failed to create temporary test dir: %s", tdir)
+	}
+
+	files := map[string]string{
+		"_vars.scss": "$fg: #333; // text colour\n$pad: 1em !default;\n",
+		"style.scss": `@import "vars";
+$pad: 2em !default;
+/* mixins */
+@mixin box($p, $border: none) {
+	padding: $p;
+	border: $border;
+}
+a { background: url(//cdn.example.com/a.png); }
+nav {
+	color: $fg;
+	ul, ol { @include box($pad); }
+	&.open > a:hover { color: red; }
+	@media (max-width: 600px) { display: none; }
+	.item-#{$pad} { margin: 0; }
+}
+`,
+	}
+	for fname, src := range files {
+		if err := ioutil.WriteFile(filepath.Join(tdir, fname), []byte(src), 0644); err != nil {
+			test.Error("setup failed:", err)
+		}
+	}
+
+	css, err := CompileScss(filepath.Join(tdir, "style.scss"))
+	if err != nil {
+		test.Fatal(err)
+	}
+	expect := `a {
+	background: url(//cdn.example.com/a.png);
+}
+nav {
+	color: #333;
+}
+nav ul, nav ol {
+	padding: 1em;
+	border: none;
+}
+nav.open > a:hover {
+	color: red;
+}
+@media (max-width: 600px) {
+nav {
+	display: none;
+}
+}
+nav .item-1em {
+	margin: 0;
+}
+`
+	if string(css) != expect {
+		test.Errorf("CompileScss returned:\n%s\nshould be:\n%s", css, expect)
+	}
+
+	if err = ioutil.WriteFile(filepath.Join(tdir, "bad.scss"), []byte("a { color: $nope; }"), 0644); err != nil {
+		test.Error("setup failed:", err)
+	}
+	if _, err = CompileScss(filepath.Join(tdir, "bad.scss")); err == nil {
+		test.Error("CompileScss did not fail for an undefined variable")
+	}
+
+	bad := map[string]string{
+		"cycle-a.scss": `@import "cycle-b"; a { color: red; }`,
+		"cycle-b.scss": `@import "cycle-a";`,
+		"param.scss":   `@mixin f(:x) { color: red; } a { @include f(1); }`,
+	}
+	for fname, src := range bad {
+		if err = ioutil.WriteFile(filepath.Join(tdir, fname), []byte(src), 0644); err != nil {
+			test.Error("setup failed:", err)
+		}
+	}
+	if _, err = CompileScss(filepath.Join(tdir, "cycle-a.scss")); err == nil || !strings.Contains(err.Error(), "import cycle") {
+		test.Errorf("CompileScss did not fail for an import cycle: %v", err)
+	}
+	if _, err = CompileScss(filepath.Join(tdir, "param.scss")); err == nil {
+		test.Error("CompileScss did not fail for an empty mixin parameter name")
+	}
+
+	if err = os.RemoveAll(tdir); err != nil {
+		test.Error(err)
+	}
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// SearchConfig is the data structure containing all key/values that
+// control how the search index is generated.
+type SearchConfig struct {
+	// Output is the filename of the search index written to `Config.Output`.
+	// If it's empty, no search index is generated.
+	Output string
+	// Sections is a list of page paths (e.g. "/blog"), only pages at or below
+	// one of these paths are indexed. If it's empty, all pages are indexed.
+	Sections []string
+	// Meta is a list of `Page.Meta` keys, who's values are added to the
+	// indexed `.Meta` of each page and tokenised.
+	Meta []string
+	// SummaryLength is the maximum number of characters in a summary
+	// generated from the page text (when a page has no "summary" Meta).
+	SummaryLength int
+}
+
+// SearchIndex is the data structure written as JSON to the search index file.
+// `.Postings` maps each token to the indexes of the `.Pages` it's found in.
+type SearchIndex struct {
+	Pages    []SearchEntry    `json:"pages"`
+	Postings map[string][]int `json:"postings"`
+}
+
+// SearchEntry is the indexed data of a single `Page`.
+type SearchEntry struct {
+	Path    string                 `json:"path"`
+	Title   string                 `json:"title"`
+	Tags    []string               `json:"tags,omitempty"`
+	Summary string                 `json:"summary,omitempty"`
+	Text    string                 `json:"text"`
+	Meta    map[string]interface{} `json:"meta,omitempty"`
+}
+
+var htmlTagRegexp = regexp.MustCompile(`(?s)<script.*?</script>|<style.*?</style>|<[^>]*>`)
+
+// stripHTML returns `s` with all HTML tags removed, entities unescaped and
+// any runs of whitespace replaced with a single space.
+func stripHTML(s string) string {
+	s = html.UnescapeString(htmlTagRegexp.ReplaceAllString(s, " "))
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// tokenise splits `s` into lowercase tokens of letters and digits.
+// Tokens with less than 2 characters are dropped.
+func tokenise(s string) (tokens []string) {
+	fields := strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	for _, f := range fields {
+		if len([]rune(f)) >= 2 {
+			tokens = append(tokens, f)
+		}
+	}
+	return
+}
+
+// summarise returns the first `length` characters of `text`, cut at the
+// last space.
+func summarise(text string, length int) string {
+	if runes := []rune(text); len(runes) > length {
+		text = string(runes[:length])
+		if i := strings.LastIndex(text, " "); i > 0 {
+			text = text[:i]
+		}
+		text += "..."
+	}
+	return text
+}
+
+func inSections(path string, sections []string) bool {
+	if len(sections) == 0 {
+		return true
+	}
+	for _, s := range sections {
+		s = "/" + strings.Trim(s, "/")
+		if s == "/" || path == s || strings.HasPrefix(path, s+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// NewSearchEntry returns the indexed data of `p` for `cfg`.
+func NewSearchEntry(p Page, cfg SearchConfig) (e SearchEntry) {
+	e.Path = p.Path
+	if v, ok := metaValue(p.Meta, "title", "Title"); ok {
+		e.Title = fmt.Sprint(v)
+	}
+	if v, ok := metaValue(p.Meta, "tags", "Tags"); ok {
+		e.Tags = metaStrings(v)
+	}
+
+	var text []string
+	for _, c := range p.Contents {
+		text = append(text, stripHTML(string(c)))
+	}
+	e.Text = strings.Join(text, " ")
+
+	if v, ok := metaValue(p.Meta, "summary", "Summary"); ok {
+		e.Summary = fmt.Sprint(v)
+	} else if cfg.SummaryLength > 0 {
+		e.Summary = summarise(e.Text, cfg.SummaryLength)
+	}
+
+	for _, key := range cfg.Meta {
+		if v, ok := p.Meta[key]; ok {
+			if e.Meta == nil {
+				e.Meta = make(map[string]interface{})
+			}
+			e.Meta[key] = v
+		}
+	}
+	return
+}
+
+// tokens returns all unique tokens found in the values of `e`.
+func (e SearchEntry) tokens() (tokens []string) {
+	values := append([]string{e.Title, e.Summary, e.Text}, e.Tags...)
+	for _, v := range e.Meta {
+		values = append(values, metaStrings(v)...)
+	}
+
+	unique := make(map[string]bool)
+	for _, v := range values {
+		for _, t := range tokenise(v) {
+			if !unique[t] {
+				unique[t] = true
+				tokens = append(tokens, t)
+			}
+		}
+	}
+	return
+}
+
+// BuildSearchIndex returns a `SearchIndex` of all `pages` in the sections
+// set in `cfg`.
+func BuildSearchIndex(pages []Page, cfg SearchConfig) (index SearchIndex) {
+	sorted := make([]Page, len(pages))
+	copy(sorted, pages)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Path < sorted[j].Path })
+
+	index.Pages = make([]SearchEntry, 0)
+	index.Postings = make(map[string][]int)
+	for _, p := range sorted {
+		if !inSections(p.Path, cfg.Sections) {
+			continue
+		}
+		e := NewSearchEntry(p, cfg)
+		for _, t := range e.tokens() {
+			index.Postings[t] = append(index.Postings[t], len(index.Pages))
+		}
+		index.Pages = append(index.Pages, e)
+	}
+	return
+}
+
+// WriteSearchIndex writes the JSON of `BuildSearchIndex(pages, cfg)` to
+// `outDir/cfg.Output`.
+func WriteSearchIndex(pages []Page, cfg SearchConfig, outDir string) (out string, err error) {
+	var buf []byte
+	if buf, err = json.Marshal(BuildSearchIndex(pages, cfg)); err == nil {
+		out = filepath.Join(outDir, cfg.Output)
+		if err = os.MkdirAll(filepath.Dir(out), 0755); err == nil {
+			err = replaceFile(out, buf, 0644)
+		}
+	}
+	return
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestStripHTML(test *testing.T) {
+	test.Parallel()
+
+	in := "<h1 id=\"x\">Title</h1>\n<p>some &amp; <b>bold</b>\ttext</p><script>var x;</script>"
+	if out := stripHTML(in); out != "Title some & bold text" {
+		test.Fatalf("stripHTML returned '%s'", out)
+	}
+}
+
+func TestWriteSearchIndex(test *testing.T) {
+	test.Parallel()
+
+	tdir := filepath.Join(os.TempDir(), "pagr_test", "TestWriteSearchIndex")
+	if err := os.MkdirAll(tdir, 0775); err != nil {
+		test.Errorf("failed to create temporary test dir: %s", tdir)
+	}
+
+	pages := []Page{
+		NewPage("/", time.Now()),
+		NewPage("/blog/hello-world", time.Now()),
+		NewPage("/blog/second", time.Now()),
+	}
+	pages[1].Contents = append(pages[1].Contents, "<p>Pagr builds <em>static</em> sites</p>")
+	pages[1].Meta["tags"] = []interface{}{"go", "web"}
+	pages[1].Meta["author"] = "Jane"
+	pages[2].Meta["Summary"] = "a summary"
+
+	cfg := SearchConfig{Output: "search.json", Sections: []string{"blog"}, Meta: []string{"author"}, SummaryLength: 12}
+	out, err := WriteSearchIndex(pages, cfg, tdir)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	var index SearchIndex
+	if buf, err := ioutil.ReadFile(out); err != nil {
+		test.Fatal(err)
+	} else if err = json.Unmarshal(buf, &index); err != nil {
+		test.Fatal(err)
+	}
+
+	if len(index.Pages) != 2 {
+		test.Fatalf("%d pages indexed (should be 2)", len(index.Pages))
+	}
+	e := index.Pages[0]
+	if e.Path != "/blog/hello-world" || e.Title != "Hello World" || len(e.Tags) != 2 ||
+		e.Text != "Pagr builds static sites" || e.Summary != "Pagr builds..." || e.Meta["author"] != "Jane" {
+		test.Errorf("invalid search entry: %+v", e)
+	}
+	if index.Pages[1].Summary != "a summary" {
+		test.Errorf("invalid Summary: '%s'", index.Pages[1].Summary)
+	}
+	for token, postings := range map[string][]int{"static": {0}, "jane": {0}, "summary": {1}, "hello": {0}} {
+		if p := index.Postings[token]; len(p) != len(postings) || p[0] != postings[0] {
+			test.Errorf("invalid postings for '%s': %v", token, p)
+		}
+	}
+
+	if err = os.RemoveAll(tdir); err != nil {
+		test.Error(err)
+	}
+}
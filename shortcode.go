@@ -0,0 +1,234 @@
+package main
+
+import (
+	"fmt"
+	hmpl "html/template"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"notabug.org/gearsix/suti"
+)
+
+// shortcodesDir is the subdirectory of the templates directory that
+// shortcode templates are loaded from.
+const shortcodesDir = "shortcodes"
+
+// Shortcode is the data a shortcode template is executed with, for the
+// shortcode `{{< Name Args... Params... >}}Inner{{< /Name >}}`.
+// The inner content of `{{% %}}` shortcodes is converted from markdown.
+type Shortcode struct {
+	Name   string
+	Page   *Page
+	Args   []string          // positional parameters
+	Params map[string]string // named parameters (key="value")
+	Inner  hmpl.HTML
+	Parent *Shortcode // the shortcode this one is nested in, if any
+}
+
+// Get returns the positional parameter at `key` (if it's an int) or the
+// named parameter `key`, an empty string is returned if it's not set.
+func (s *Shortcode) Get(key interface{}) string {
+	switch k := key.(type) {
+	case int:
+		if k >= 0 && k < len(s.Args) {
+			return s.Args[k]
+		}
+	case string:
+		return s.Params[k]
+	}
+	return ""
+}
+
+// ShortcodeSet maps shortcode names to the template they're rendered with.
+type ShortcodeSet map[string]suti.Template
+
+// shortcodes is the ShortcodeSet used when converting content files.
+var shortcodes ShortcodeSet
+
+var shortcodeTagRegexp = regexp.MustCompile(`{{([<%])\s*(/?)([\w-]+)((?:\s+(?:[\w-]+=)?(?:"[^"]*"|[^\s"%>]+))*)\s*([>%])}}`)
+var shortcodeArgRegexp = regexp.MustCompile(`(?:([\w-]+)=)?("[^"]*"|[^\s"]+)`)
+
+// LoadShortcodeDir loads every template file in `dirs` as a shortcode, named
+// by it's filename (without extension). Files in later `dirs` override files
+// with the same relative path in earlier `dirs`. Any `dirs` that don't exist
+// are skipped.
+func LoadShortcodeDir(dirs ...string) (ShortcodeSet, error) {
+	return loadNamedTemplates("shortcode", dirs...)
+}
+
+// loadNamedTemplates loads every template file in `dirs` (and their
+// sub-directories), mapped by it's filename (without extension), see
+// `overlayFiles`. An error is returned if two files have the same name,
+// `kind` is used in the error.
+func loadNamedTemplates(kind string, dirs ...string) (set map[string]suti.Template, err error) {
+	set = make(map[string]suti.Template)
+	var files map[string]string
+	var rels []string
+	if files, rels, err = overlayFiles(existingDirs(dirs)); err != nil {
+		return
+	}
+	paths := make(map[string]string)
+	for _, rel := range rels {
+		path := files[rel]
+		lang := strings.TrimPrefix(filepath.Ext(path), ".")
+		if suti.IsSupportedTemplateLang(lang) == -1 {
+			continue
+		}
+		name := templateName(path)
+		if other, ok := paths[name]; ok {
+			return nil, fmt.Errorf("%s name collision: '%s' is defined by %s and %s", kind, name, other, path)
+		}
+		paths[name] = path
+		if set[name], err = loadTemplateFilepath(path); err != nil {
+			return nil, fmt.Errorf("%s: %s", path, err)
+		}
+	}
+	return
+}
+
+// shortcodeTag is a parsed shortcode tag found in content.
+type shortcodeTag struct {
+	start, end int // location in the source
+	name       string
+	closing    bool
+	markdown   bool
+	args       string
+}
+
+func findShortcodeTags(src string) (tags []shortcodeTag) {
+	for _, m := range shortcodeTagRegexp.FindAllStringSubmatchIndex(src, -1) {
+		open, close := src[m[2]:m[3]], src[m[10]:m[11]]
+		if (open == "<") != (close == ">") {
+			continue
+		}
+		tags = append(tags, shortcodeTag{
+			start:    m[0],
+			end:      m[1],
+			name:     src[m[6]:m[7]],
+			closing:  m[5] > m[4],
+			markdown: open == "%",
+			args:     src[m[8]:m[9]],
+		})
+	}
+	return
+}
+
+// parseShortcodeArgs returns the positional & named parameters in `args`.
+func parseShortcodeArgs(args string) (positional []string, named map[string]string) {
+	named = make(map[string]string)
+	for _, m := range shortcodeArgRegexp.FindAllStringSubmatch(args, -1) {
+		value := m[2]
+		if unquoted, err := strconv.Unquote(value); err == nil {
+			value = unquoted
+		} else {
+			value = strings.Trim(value, `"`)
+		}
+		if len(m[1]) > 0 {
+			named[m[1]] = value
+		} else {
+			positional = append(positional, value)
+		}
+	}
+	return
+}
+
+// Render replaces all the shortcodes in `src` with the result of executing
+// their template for the page `p`. `fpath` is the file `src` was loaded
+// from (used in error messages). Unknown shortcodes are left as-is.
+func (set ShortcodeSet) Render(src string, p *Page, fpath string) (string, error) {
+	return set.render(src, p, nil, fpath, 0, nil)
+}
+
+// render renders the shortcodes in `src` (found at `offset` in the file
+// `fpath`), nested in `parent`. If `replace` is not nil, it's called with
+// the result of each shortcode and it's return value is written instead.
+func (set ShortcodeSet) render(src string, p *Page, parent *Shortcode, fpath string, offset int, replace func(string) string) (string, error) {
+	var out strings.Builder
+	tags := findShortcodeTags(src)
+	errorf := func(tag shortcodeTag, format string, args ...interface{}) error {
+		line := strings.Count(src[:tag.start], "\n") + 1 + offset
+		return fmt.Errorf("%s:%d: shortcode '%s': %s", fpath, line, tag.name, fmt.Sprintf(format, args...))
+	}
+
+	last := 0
+	for i := 0; i < len(tags); i++ {
+		tag := tags[i]
+		if tag.start < last {
+			continue
+		}
+		tmpl, ok := set[tag.name]
+		if !ok {
+			continue
+		}
+		if tag.closing {
+			return "", errorf(tag, "closing tag without an opening tag")
+		}
+
+		sc := &Shortcode{Name: tag.name, Page: p, Parent: parent}
+		sc.Args, sc.Params = parseShortcodeArgs(tag.args)
+
+		// find the matching closing tag, if any
+		end := tag.end
+		depth := 0
+		for j := i + 1; j < len(tags); j++ {
+			if tags[j].name != tag.name {
+				continue
+			} else if !tags[j].closing {
+				depth++
+			} else if depth > 0 {
+				depth--
+			} else {
+				innerOffset := offset + strings.Count(src[:tag.end], "\n")
+				inner, err := set.render(src[tag.end:tags[j].start], p, sc, fpath, innerOffset, nil)
+				if err != nil {
+					return "", err
+				}
+				if tag.markdown {
+					if inner, err = convertMarkdownToHTML([]byte(inner)); err != nil {
+						return "", errorf(tag, "%s", err)
+					}
+				}
+				sc.Inner = hmpl.HTML(strings.TrimSpace(inner))
+				end = tags[j].end
+				break
+			}
+		}
+
+		result, err := tmpl.Execute(sc)
+		if err != nil {
+			return "", errorf(tag, "%s", err)
+		}
+		out.WriteString(src[last:tag.start])
+		if replace != nil {
+			out.WriteString(replace(result.String()))
+		} else {
+			out.WriteString(result.String())
+		}
+		last = end
+	}
+	out.WriteString(src[last:])
+	return out.String(), nil
+}
+
+// renderMarkdownShortcodes replaces the shortcodes in the markdown `src`
+// with placeholders, so their output isn't changed by markdown conversion.
+// The returned `restore` function replaces the placeholders in the
+// converted HTML with the shortcode output.
+func (set ShortcodeSet) renderMarkdownShortcodes(src string, p *Page, fpath string) (out string, restore func(html string) string, err error) {
+	var results []string
+	out, err = set.render(src, p, nil, fpath, 0, func(result string) string {
+		results = append(results, result)
+		return fmt.Sprintf("pagrshortcode%dx", len(results)-1)
+	})
+	restore = func(html string) string {
+		for i, result := range results {
+			placeholder := fmt.Sprintf("pagrshortcode%dx", i)
+			html = strings.Replace(html, "<p>"+placeholder+"</p>", result, -1)
+			html = strings.Replace(html, placeholder, result, -1)
+		}
+		return html
+	}
+	return
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestShortcodes(test *testing.T) {
+	test.Parallel()
+
+	tdir := filepath.Join(os.TempDir(), "pagr_test", "TestShortcodes")
+	files := map[string]string{
+		"figure.hmpl": `<figure><img src="{{.Get "src"}}"><figcaption>{{.Get "caption"}}</figcaption></figure>`,
+		"note.hmpl":   `<div class="note">{{.Get 0}}: {{.Inner}}</div>`,
+		"page.tmpl":   `{{.Page.Path}}{{with .Parent}} in {{.Name}}{{end}}`,
+	}
+	for fname, data := range files {
+		if err := os.MkdirAll(tdir, 0775); err != nil {
+			test.Fatal("setup failed:", err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(tdir, fname), []byte(data), 0644); err != nil {
+			test.Fatal("setup failed:", err)
+		}
+	}
+
+	set, err := LoadShortcodeDir(tdir)
+	if err != nil {
+		test.Fatal(err)
+	} else if len(set) != 3 {
+		test.Fatalf("LoadShortcodeDir loaded %d shortcodes (should be 3)", len(set))
+	}
+
+	p := NewPage("/test", time.Now())
+	html, err := set.Render(`<p>{{< figure src="a.png" caption="A <b>" >}}</p> {{< unknown >}}`, &p, "index.html")
+	if err != nil {
+		test.Fatal(err)
+	} else if expect := `<p><figure><img src="a.png"><figcaption>A &lt;b&gt;</figcaption></figure></p> {{< unknown >}}`; html != expect {
+		test.Errorf("Render returned '%s' (should be '%s')", html, expect)
+	}
+
+	md := "# title\n\n{{% note \"Warning\" %}}\n*careful* {{< page >}}\n{{% /note %}}\n\ntext {{< page >}}\n"
+	src, restore, err := set.renderMarkdownShortcodes(md, &p, "index.md")
+	if err != nil {
+		test.Fatal(err)
+	}
+	html, err = convertMarkdownToHTML([]byte(src))
+	if err != nil {
+		test.Fatal(err)
+	}
+	expect := "<h1 id=\"title\">title</h1>\n" +
+		"<div class=\"note\">Warning: <p><em>careful</em> /test in note</p></div>\n" +
+		"<p>text /test</p>\n"
+	if html = restore(html); html != expect {
+		test.Errorf("invalid markdown output:\n%s\nshould be:\n%s", html, expect)
+	}
+
+	if _, err = set.Render("line\n{{< /note >}}", &p, "index.html"); err == nil || !strings.HasPrefix(err.Error(), "index.html:2:") {
+		test.Errorf("Render returned an invalid error for an unopened closing tag: %v", err)
+	}
+
+	if err = os.RemoveAll(tdir); err != nil {
+		test.Error(err)
+	}
+}
@@ -42,13 +42,16 @@ func BuildCrumbs(p Page, pages []Page) (crumbs []*Page) {
 }
 
 // Sitemap parses `pages` to determine the `.Nav` values for each element in `pages`
-// based on their `.Path` value. These values will be set in the returned Content
+// based on their `.Path` value. These values will be set in the returned Content.
+// Any existing `.Nav` values are reset, so it can be called again after pages are added.
 func BuildSitemap(pages []Page) []Page {
 	root := findRootPage(pages)
 
 	for i, p := range pages {
 		pdepth := readPageDepth(p)
 
+		p.Nav = Nav{}
+
 		p.Nav.Root = root
 
 		if pdepth == 1 && p.Path != "/" {
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// stagingDir returns the path of the staging directory used to build `out`,
+// it's a hidden sibling of `out` so that it's on the same filesystem.
+func stagingDir(out string) string {
+	out = filepath.Clean(out)
+	return filepath.Join(filepath.Dir(out), "."+filepath.Base(out)+".staging")
+}
+
+// backupDir returns the path that the previous build of `out` is kept at.
+func backupDir(out string) string {
+	return filepath.Clean(out) + ".bak"
+}
+
+// BeginStaging creates the staging directory for the output directory `out`
+// and returns it's path. Any staging directory left by a failed build is
+// removed first. The staging directory starts as a copy of `out` (without
+// the files matching the `keep` glob patterns, see `CommitStaging`), with
+// the same permissions & modification times, so unchanged files aren't
+// rewritten and stale files are only removed by -clean.
+func BeginStaging(out string, keep []string) (staging string, err error) {
+	staging = stagingDir(out)
+	if err = os.RemoveAll(staging); err != nil {
+		return
+	} else if err = os.MkdirAll(staging, 0755); err != nil {
+		return
+	}
+
+	out = filepath.Clean(out)
+	err = filepath.Walk(out, func(fpath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(out, fpath)
+		if rel == "." {
+			return nil
+		} else if keepFile(rel, keep) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		dst := filepath.Join(staging, rel)
+		if info.IsDir() {
+			return os.MkdirAll(dst, info.Mode().Perm())
+		} else if !info.Mode().IsRegular() {
+			return nil
+		}
+		return copyFile(fpath, dst, info, config.CopyMode == CopyModeReflink)
+	})
+	if os.IsNotExist(err) {
+		err = nil
+	}
+	return
+}
+
+// CommitStaging swaps the `staging` directory into place at `out`. The files
+// in `out` matching the `keep` glob patterns (see `keepFile`) are moved into
+// `staging` first, unless the build wrote a file at the same path.
+// The previous `out` directory is kept at `backupDir(out)`, replacing any
+// previous backup. The swap isn't atomic (it's two renames, so `out`
+// briefly doesn't exist), if it fails the previous `out` is restored along
+// with it's kept files.
+func CommitStaging(staging, out string, keep []string) (err error) {
+	out = filepath.Clean(out)
+	if _, err = os.Stat(out); os.IsNotExist(err) {
+		return os.Rename(staging, out)
+	} else if err != nil {
+		return
+	}
+
+	var moved []string // the kept files moved into `staging`
+	restore := func() {
+		for _, rel := range moved {
+			os.Rename(filepath.Join(staging, rel), filepath.Join(out, rel))
+		}
+	}
+
+	err = filepath.Walk(out, func(fpath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(out, fpath)
+		if rel == "." || !keepFile(rel, keep) {
+			return nil
+		}
+		dst := filepath.Join(staging, rel)
+		if _, e := os.Stat(dst); e == nil {
+			return nil
+		}
+		if err = os.MkdirAll(filepath.Dir(dst), 0755); err == nil {
+			if err = os.Rename(fpath, dst); err == nil {
+				moved = append(moved, rel)
+			}
+		}
+		if err == nil && info.IsDir() {
+			err = filepath.SkipDir
+		}
+		return err
+	})
+	if err != nil {
+		restore()
+		return
+	}
+
+	backup := backupDir(out)
+	if err = os.RemoveAll(backup); err == nil {
+		err = os.Rename(out, backup)
+	}
+	if err != nil {
+		restore()
+		return
+	}
+	if err = os.Rename(staging, out); err != nil {
+		os.Rename(backup, out)
+		restore()
+	}
+	return
+}
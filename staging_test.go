@@ -0,0 +1,92 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCommitStaging(test *testing.T) {
+	test.Parallel()
+
+	tdir := filepath.Join(os.TempDir(), "pagr_test", "TestCommitStaging")
+	out := filepath.Join(tdir, "out")
+	write := func(fpath, data string) {
+		if err := os.MkdirAll(filepath.Dir(fpath), 0775); err != nil {
+			test.Fatal("setup failed:", err)
+		}
+		if err := ioutil.WriteFile(fpath, []byte(data), 0644); err != nil {
+			test.Fatal("setup failed:", err)
+		}
+	}
+	read := func(fpath string) string {
+		buf, err := ioutil.ReadFile(fpath)
+		if err != nil {
+			test.Error(err)
+		}
+		return string(buf)
+	}
+
+	for i, expect := range []string{"first", "second"} {
+		staging, err := BeginStaging(out, []string{".git"})
+		if err != nil {
+			test.Fatal(err)
+		}
+		if _, err = os.Stat(filepath.Join(staging, ".git")); err == nil {
+			test.Error("kept file was copied to the staging directory")
+		}
+		write(filepath.Join(staging, "index.html"), expect)
+		if i == 0 {
+			write(filepath.Join(staging, "old.html"), "old")
+			write(filepath.Join(staging, ".git", "HEAD"), "ref")
+		}
+
+		if err = CommitStaging(staging, out, []string{".git"}); err != nil {
+			test.Fatal(err)
+		}
+		if _, err = os.Stat(staging); err == nil {
+			test.Errorf("staging directory %s still exists", staging)
+		}
+		if data := read(filepath.Join(out, "index.html")); data != expect {
+			test.Errorf("output contains '%s' (should be '%s')", data, expect)
+		}
+		if data := read(filepath.Join(out, ".git", "HEAD")); data != "ref" {
+			test.Errorf("kept file contains '%s'", data)
+		}
+	}
+
+	if data := read(filepath.Join(out, "old.html")); data != "old" {
+		test.Errorf("file from the previous build contains '%s' (should be 'old')", data)
+	}
+	if data := read(filepath.Join(backupDir(out), "index.html")); data != "first" {
+		test.Errorf("backup contains '%s' (should be 'first')", data)
+	}
+
+	// kept files are moved back if the commit fails, here "sub" is a file in
+	// the staging directory, so "sub/b" can't be moved after "a.txt"
+	keep := []string{"a.txt", "b"}
+	write(filepath.Join(out, "a.txt"), "a")
+	write(filepath.Join(out, "sub", "b"), "b")
+	staging, err := BeginStaging(out, keep)
+	if err != nil {
+		test.Fatal(err)
+	}
+	if err = os.RemoveAll(filepath.Join(staging, "sub")); err != nil {
+		test.Fatal("setup failed:", err)
+	}
+	write(filepath.Join(staging, "sub"), "not a directory")
+	if err = CommitStaging(staging, out, keep); err == nil {
+		test.Error("CommitStaging didn't fail")
+	}
+	if data := read(filepath.Join(out, "a.txt")); data != "a" {
+		test.Errorf("kept file wasn't restored after a failed commit: '%s'", data)
+	}
+	if _, err = os.Stat(filepath.Join(staging, "a.txt")); err == nil {
+		test.Error("kept file was left in the staging directory")
+	}
+
+	if err := os.RemoveAll(tdir); err != nil {
+		test.Error(err)
+	}
+}
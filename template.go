@@ -1,53 +1,230 @@
 package main
 
 import (
+	"fmt"
+	hmpl "html/template"
+	"io/ioutil"
 	"notabug.org/gearsix/suti"
-	"os"
 	"path/filepath"
+	"regexp"
 	"strings"
+	tmpl "text/template"
 )
 
-// LoadTemplateDir loads all files in `dir` that are not directories as a `suti.Template`
-// by calling `suti.LoadTemplateFile`. Partials for each template will be parsed from all
-// files in a directory matching the base filename of the template (not including
-// extension) if it exists.
-func LoadTemplateDir(dir string) (templates []suti.Template, err error) {
+func templateName(path string) string {
+	return strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+}
+
+// layoutsDir and partialsDir are the subdirectories of the templates
+// directory that base layouts and shared partials are loaded from.
+const (
+	layoutsDir  = "layouts"
+	partialsDir = "partials"
+)
+
+var layoutDirectiveRegexp = regexp.MustCompile(`^\s*{{-?\s*/\*\s*layout\s+"([^"]+)"\s*\*/\s*-?}}`)
+
+// templateLayout returns the name of the layout declared at the start of
+// the template `src` (e.g. `{{/* layout "base" */}}`), if there is one.
+func templateLayout(src []byte) string {
+	if m := layoutDirectiveRegexp.FindSubmatch(src); m != nil {
+		return string(m[1])
+	}
+	return ""
+}
+
+// loadTemplateFilepath loads the template at `rootPath` with `partialPaths`,
+// see `loadLayoutTemplate`.
+func loadTemplateFilepath(rootPath string, partialPaths ...string) (t suti.Template, err error) {
+	return loadLayoutTemplate(rootPath, "", partialPaths...)
+}
+
+// loadLayoutTemplate loads the template at `rootPath` with `partialPaths`.
+// If `layoutPath` is set, the template executes the layout at `layoutPath`,
+// with any blocks it defines overriding the blocks in the layout.
+// "tmpl" and "hmpl" templates are parsed with `templateFuncs`, any other
+// template language is loaded by `suti.LoadTemplateFilepath` (without layouts).
+// An error is returned if two partials have the same name.
+func loadLayoutTemplate(rootPath, layoutPath string, partialPaths ...string) (t suti.Template, err error) {
+	lang := strings.TrimPrefix(filepath.Ext(rootPath), ".")
+	if lang != "tmpl" && lang != "hmpl" {
+		if len(layoutPath) > 0 {
+			return t, fmt.Errorf("%s: layouts are only supported by tmpl & hmpl templates", rootPath)
+		}
+		return suti.LoadTemplateFilepath(rootPath, partialPaths...)
+	}
+
+	var root, base []byte
+	if root, err = ioutil.ReadFile(rootPath); err != nil {
+		return
+	}
+	base = root
+	if len(layoutPath) > 0 {
+		if base, err = ioutil.ReadFile(layoutPath); err != nil {
+			return
+		}
+	}
+
+	partials := make(map[string]string)
+	partialFiles := make(map[string]string)
+	var names []string
+	for _, path := range partialPaths {
+		if path == rootPath || path == layoutPath {
+			continue
+		}
+		name := templateName(path)
+		if other, ok := partialFiles[name]; ok && other != path {
+			return t, fmt.Errorf("partial name collision: '%s' is defined by %s and %s", name, other, path)
+		}
+		var buf []byte
+		if buf, err = ioutil.ReadFile(path); err != nil {
+			return
+		}
+		partials[name] = string(buf)
+		partialFiles[name] = path
+		names = append(names, name)
+	}
+
+	t.Name = templateName(rootPath)
+	var parse func(name, src string) error
+	if lang == "tmpl" {
+		var tt *tmpl.Template
+		if tt, err = tmpl.New(t.Name).Funcs(templateFuncs).Parse(string(base)); err != nil {
+			return
+		}
+		parse = func(name, src string) (err error) {
+			_, err = tt.New(name).Parse(src)
+			return
+		}
+		t.T = tt
+	} else {
+		var ht *hmpl.Template
+		if ht, err = hmpl.New(t.Name).Funcs(templateFuncs).Parse(string(base)); err != nil {
+			return
+		}
+		parse = func(name, src string) (err error) {
+			_, err = ht.New(name).Parse(src)
+			return
+		}
+		t.T = ht
+	}
+
+	for _, name := range names {
+		if err = parse(name, partials[name]); err != nil {
+			return
+		}
+	}
+	// parsed last, so it's blocks override those in the layout & partials
+	if len(layoutPath) > 0 {
+		err = parse(t.Name+".page", string(root))
+	}
+	return
+}
+
+// LoadTemplateDir loads all files in `dirs` that are not directories as a `suti.Template`
+// by calling `loadLayoutTemplate`. Partials for each template will be parsed from all
+// files in it's directory (and sub-directories) with the same file extension, and
+// all files in "partials" with the same file extension.
+// Files in "layouts" are base layouts, which are only used by templates
+// that declare them (see `templateLayout`).
+// Files in "shortcodes" and "hooks" are ignored, see `LoadShortcodeDir`
+// and `LoadRenderHookDir`.
+// Files in later `dirs` override files with the same relative path in
+// earlier `dirs` (e.g. theme templates, see `Theme`).
+func LoadTemplateDir(dirs ...string) (templates []suti.Template, err error) {
+	return loadTemplateDir(dirs, nil)
+}
+
+// loadTemplateDir loads the templates in `dirs`, see `LoadTemplateDir`. If a
+// template fails to load and `onError` is not nil, the template it returns
+// for the template file `rootPath` is used instead of failing.
+func loadTemplateDir(dirs []string, onError func(rootPath string, err error) (suti.Template, error)) (templates []suti.Template, err error) {
+	var files map[string]string // map[relPath]path
+	var rels []string
+	if files, rels, err = overlayFiles(dirs); err != nil {
+		return
+	}
+
 	templatePaths := make(map[string][]string) // map[rootPath][]partialPaths...
+	layoutPaths := make(map[string]string)     // map[name.ext]layoutPath
+	sharedPaths := make(map[string]string)     // map[name.ext]partialPath (in partialsDir)
+	relPaths := make(map[string]string)        // map[path]relPath
+	var allPaths []string
 
-	err = filepath.Walk(dir, func(path string, info os.FileInfo, e error) error {
+	for _, rel := range rels {
+		path := files[rel]
 		lang := strings.TrimPrefix(filepath.Ext(path), ".")
-		if e != nil || info.IsDir() || strings.Contains(path, ".ignore") || suti.IsSupportedTemplateLang(lang) == -1 {
-			return e
+		if suti.IsSupportedTemplateLang(lang) == -1 {
+			continue
 		}
 
-		templatePaths[path] = make([]string, 0)
-		return e
-	})
+		key := templateName(path) + filepath.Ext(path)
+		switch {
+		case inDir(rel, shortcodesDir), inDir(rel, hooksDir):
+			continue
+		case inDir(rel, layoutsDir):
+			layoutPaths[key] = path
+			continue
+		case inDir(rel, partialsDir):
+			if other, ok := sharedPaths[key]; ok {
+				return nil, fmt.Errorf("partial name collision: '%s' is defined by %s and %s", templateName(path), other, path)
+			}
+			sharedPaths[key] = path
+		default:
+			templatePaths[path] = make([]string, 0)
+		}
+		relPaths[path] = rel
+		allPaths = append(allPaths, path)
+	}
 
-	err = filepath.Walk(dir, func(path string, info os.FileInfo, e error) error {
-		lang := strings.TrimPrefix(filepath.Ext(path), ".")
-		if e != nil || info.IsDir() || ignoreFile(path) || suti.IsSupportedTemplateLang(lang) == -1 {
-			return e
+	// templates that declare a layout are never used as partials, since
+	// their blocks would override those of other templates
+	layoutNames := make(map[string]string) // map[rootPath]layout
+	for rootPath := range templatePaths {
+		var src []byte
+		if src, err = ioutil.ReadFile(rootPath); err != nil {
+			return
 		}
+		layoutNames[rootPath] = templateLayout(src)
+	}
 
-		for t := range templatePaths {
-			if strings.Contains(path, filepath.Dir(t)) &&
-				filepath.Ext(t) == filepath.Ext(path) {
+	for t := range templatePaths {
+		names := map[string]string{templateName(t): t} // map[name]path
+		for _, path := range allPaths {
+			if filepath.Ext(t) != filepath.Ext(path) || (path != t && len(layoutNames[path]) > 0) {
+				continue
+			}
+			if rel := relPaths[path]; inDir(rel, filepath.Dir(relPaths[t])) || inDir(rel, partialsDir) {
+				// a partial with the same name as another would replace it
+				if other, ok := names[templateName(path)]; ok && path != t {
+					return nil, fmt.Errorf("template name collision in %s: '%s' is defined by %s and %s", t, templateName(path), other, path)
+				}
+				names[templateName(path)] = path
 				templatePaths[t] = append(templatePaths[t], path)
 			}
 		}
-		return e
-	})
+	}
 
-	if err == nil {
-		var t suti.Template
-		for rootPath, partialPaths := range templatePaths {
-			t, err = suti.LoadTemplateFilepath(rootPath, partialPaths...)
-			if err != nil {
-				break
+	var t suti.Template
+	for rootPath, partialPaths := range templatePaths {
+		var layoutPath string
+		if layout := layoutNames[rootPath]; len(layout) > 0 {
+			var ok bool
+			if layoutPath, ok = layoutPaths[layout+filepath.Ext(rootPath)]; !ok {
+				err = fmt.Errorf("%s: layout '%s' not found in %s", rootPath, layout, layoutsDir)
 			}
-			templates = append(templates, t)
 		}
+
+		if err == nil {
+			t, err = loadLayoutTemplate(rootPath, layoutPath, partialPaths...)
+		}
+		if err != nil && onError != nil {
+			t, err = onError(rootPath, err)
+		}
+		if err != nil {
+			break
+		}
+		templates = append(templates, t)
 	}
 
 	return
@@ -1,9 +1,12 @@
 package main
 
 import (
+	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestLoadTemplateDir(t *testing.T) {
@@ -31,3 +34,109 @@ func TestLoadTemplateDir(t *testing.T) {
 		t.Error(err)
 	}
 }
+
+func TestLoadTemplateFilepath(t *testing.T) {
+	t.Parallel()
+
+	tdir := filepath.Join(os.TempDir(), "pagr_test", "TestLoadTemplateFilepath")
+	if err := os.MkdirAll(tdir, 0775); err != nil {
+		t.Errorf("failed to create temporary test dir: %s", tdir)
+	}
+
+	root := filepath.Join(tdir, "root.hmpl")
+	partial := filepath.Join(tdir, "partial.hmpl")
+	if err := ioutil.WriteFile(root, []byte(`{{template "partial" .}} {{asset "/style.css"}}`), 0644); err != nil {
+		t.Error("setup failed:", err)
+	}
+	if err := ioutil.WriteFile(partial, []byte(`{{.Path}}`), 0644); err != nil {
+		t.Error("setup failed:", err)
+	}
+
+	tmpl, err := loadTemplateFilepath(root, partial)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tmpl.Name != "root" {
+		t.Errorf("invalid template Name: '%s'", tmpl.Name)
+	}
+	buf, err := tmpl.Execute(NewPage("/test", time.Now()))
+	if err != nil {
+		t.Fatal(err)
+	} else if buf.String() != "/test /style.css" {
+		t.Fatalf("invalid result: '%s'", buf.String())
+	}
+
+	if err = os.RemoveAll(tdir); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestLoadTemplateDirLayouts(t *testing.T) {
+	t.Parallel()
+
+	tdir := filepath.Join(os.TempDir(), "pagr_test", "TestLoadTemplateDirLayouts")
+	files := map[string]string{
+		"layouts/base.hmpl":      `<title>{{block "title" .}}site{{end}}</title>{{template "nav" .}}<main>{{block "main" .}}{{end}}</main>`,
+		"partials/nav.hmpl":      `<nav>{{.Path}}</nav>`,
+		"default.hmpl":           `{{/* layout "base" */}}{{define "main"}}default{{end}}`,
+		"blog/single.hmpl":       `{{/* layout "base" */}}{{define "title"}}post{{end}}{{define "main"}}post{{end}}`,
+		"plain.tmpl":             `{{.Path}}`,
+		"partials/a/shared.tmpl": `a`,
+	}
+	for fname, data := range files {
+		fpath := filepath.Join(tdir, filepath.FromSlash(fname))
+		if err := os.MkdirAll(filepath.Dir(fpath), 0775); err != nil {
+			t.Fatal("setup failed:", err)
+		}
+		if err := ioutil.WriteFile(fpath, []byte(data), 0644); err != nil {
+			t.Fatal("setup failed:", err)
+		}
+	}
+
+	tmpls, err := LoadTemplateDir(tdir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := map[string]string{
+		"default": "<title>site</title><nav>/test</nav><main>default</main>",
+		"single":  "<title>post</title><nav>/test</nav><main>post</main>",
+		"plain":   "/test",
+	}
+	if len(tmpls) != len(expect) {
+		t.Fatalf("LoadTemplateDir returned %d templates (should be %d)", len(tmpls), len(expect))
+	}
+	for _, tmpl := range tmpls {
+		buf, err := tmpl.Execute(NewPage("/test", time.Now()))
+		if err != nil {
+			t.Error(err)
+		} else if buf.String() != expect[tmpl.Name] {
+			t.Errorf("template '%s' returned '%s' (should be '%s')", tmpl.Name, buf.String(), expect[tmpl.Name])
+		}
+	}
+
+	collision := filepath.Join(tdir, "partials", "b", "shared.tmpl")
+	if err = os.MkdirAll(filepath.Dir(collision), 0775); err != nil {
+		t.Fatal("setup failed:", err)
+	}
+	if err = ioutil.WriteFile(collision, []byte("b"), 0644); err != nil {
+		t.Fatal("setup failed:", err)
+	}
+	if _, err = LoadTemplateDir(tdir); err == nil {
+		t.Error("LoadTemplateDir did not fail for colliding partials")
+	}
+	if err = os.Remove(collision); err != nil {
+		t.Fatal(err)
+	}
+
+	collision = filepath.Join(tdir, "blog", "plain.tmpl")
+	if err = ioutil.WriteFile(collision, []byte("blog"), 0644); err != nil {
+		t.Fatal("setup failed:", err)
+	}
+	if _, err = LoadTemplateDir(tdir); err == nil || !strings.Contains(err.Error(), "collision") {
+		t.Errorf("LoadTemplateDir did not fail for a partial with the same name as it's template: %v", err)
+	}
+
+	if err = os.RemoveAll(tdir); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"notabug.org/gearsix/suti"
+)
+
+// The subdirectories of a theme directory that it's templates, assets,
+// translations and archetypes are loaded from.
+const (
+	themeTemplatesDir  = "templates"
+	themeAssetsDir     = "assets"
+	themeI18nDir       = "i18n"
+	themeArchetypesDir = "archetypes"
+)
+
+// Theme is a shared set of templates, assets, translations & default Meta
+// that a site can use, installed as a directory in `Config.ThemesDir`:
+//   - "templates/" is loaded like `Config.Templates`
+//   - "assets/" is copied like `Config.Assets`
+//   - "i18n/" is loaded like `Config.I18n`
+//   - "archetypes/" is used like `Config.Archetypes`
+//   - "defaults.<ext>" (any supported data format) is the default Meta of
+//     every page, see `ApplyThemeMeta`
+//
+// Project files override theme files with the same path (relative to their
+// directory) and themes override the themes listed after them.
+type Theme struct {
+	Name string
+	Dir  string
+	Meta Meta
+}
+
+// LoadTheme loads the theme `name` from the directory `themesDir`.
+func LoadTheme(themesDir, name string) (t Theme, err error) {
+	t.Name = name
+	t.Dir = filepath.Join(themesDir, name)
+	if info, e := os.Stat(t.Dir); e != nil || !info.IsDir() {
+		return t, fmt.Errorf("theme '%s' not found in %s", name, themesDir)
+	}
+
+	var paths []string
+	if paths, err = filepath.Glob(filepath.Join(t.Dir, "defaults.*")); err != nil {
+		return
+	}
+	for _, fpath := range paths {
+		if suti.IsSupportedDataLang(filepath.Ext(fpath)) == -1 {
+			continue
+		}
+		if err = suti.LoadDataFilepath(fpath, &t.Meta); err != nil {
+			err = dataError(fpath, err)
+		}
+		break
+	}
+	return
+}
+
+// LoadThemes loads each theme in `names` from `themesDir`, see `LoadTheme`.
+func LoadThemes(themesDir string, names []string) (themes []Theme, err error) {
+	var t Theme
+	for _, name := range names {
+		if t, err = LoadTheme(themesDir, name); err != nil {
+			return
+		}
+		themes = append(themes, t)
+	}
+	return
+}
+
+// themePaths returns the existing `sub` directory of each theme in `themes`
+// followed by `own`, in the order they override each other (the last path
+// overrides the others).
+func themePaths(themes []Theme, sub string, own ...string) (paths []string) {
+	for i := len(themes) - 1; i >= 0; i-- {
+		path := filepath.Join(themes[i].Dir, sub)
+		if info, err := os.Stat(path); err == nil && info.IsDir() {
+			paths = append(paths, path)
+		}
+	}
+	return append(paths, own...)
+}
+
+// joinPaths returns `sub` joined to each path in `dirs`.
+func joinPaths(dirs []string, sub string) (paths []string) {
+	for _, dir := range dirs {
+		paths = append(paths, filepath.Join(dir, sub))
+	}
+	return
+}
+
+// ApplyThemeMeta merges the default Meta of each theme in `themes` into
+// the Meta of each page in `pages`, without overwriting any values.
+func ApplyThemeMeta(pages []Page, themes []Theme) {
+	for i := range pages {
+		pages[i].applyThemeMeta(themes)
+	}
+}
+
+func (p *Page) applyThemeMeta(themes []Theme) {
+	if p.Meta == nil {
+		p.Meta = make(Meta)
+	}
+	for _, t := range themes {
+		p.Meta.MergeMeta(t.Meta, false)
+	}
+}
+
+// existingDirs returns the paths in `dirs` that exist.
+func existingDirs(dirs []string) (existing []string) {
+	for _, dir := range dirs {
+		if _, err := os.Stat(dir); err == nil {
+			existing = append(existing, dir)
+		}
+	}
+	return
+}
+
+// overlayFiles returns the paths of all the files in `dirs`, mapped by
+// their path relative to the directory they're in. Files in later `dirs`
+// override files with the same relative path in earlier `dirs`.
+// The relative paths are returned sorted in `rels`.
+func overlayFiles(dirs []string) (files map[string]string, rels []string, err error) {
+	files = make(map[string]string)
+	for _, dir := range dirs {
+		dir = filepath.Clean(dir)
+		err = filepath.Walk(dir, func(path string, info os.FileInfo, e error) error {
+			if e != nil || info.IsDir() || ignoreFile(path) {
+				return e
+			}
+			rel, e := filepath.Rel(dir, path)
+			if e == nil {
+				files[rel] = path
+			}
+			return e
+		})
+		if err != nil {
+			return
+		}
+	}
+	for rel := range files {
+		rels = append(rels, rel)
+	}
+	sort.Strings(rels)
+	return
+}
+
+// assetOutputs returns the paths (relative to the output directory) that
+// the files in the assets directory `dir` are written to, the extension of
+// files transformed by a preprocessor in `pps` is replaced (see
+// `assetOutput`).
+func assetOutputs(dir string, pps []Preprocessor) map[string]bool {
+	outputs := make(map[string]bool)
+	dir = filepath.Clean(dir)
+	filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() || ignoreFile(path) {
+			return nil
+		}
+		if pp, ok := findPreprocessor(path, pps); ok && pp.isPartial(path) {
+			return nil
+		}
+		if rel, err := filepath.Rel(dir, path); err == nil {
+			outputs[assetOutput(rel, pps)] = true
+		}
+		return nil
+	})
+	return outputs
+}
+
+// assetOutput returns the path that the asset file `rel` (relative to it's
+// assets directory) is written to, relative to the output directory.
+func assetOutput(rel string, pps []Preprocessor) string {
+	if pp, ok := findPreprocessor(rel, pps); ok {
+		return pp.OutputPath(rel)
+	}
+	return rel
+}
+
+// overridden returns true if the output path `out` is in any of `outputs`
+// (see `assetOutputs`).
+func overridden(out string, outputs []map[string]bool) bool {
+	for _, o := range outputs {
+		if o[out] {
+			return true
+		}
+	}
+	return false
+}
+
+// inDir returns true if the relative path `rel` is within the relative
+// directory `parent`.
+func inDir(rel, parent string) bool {
+	return parent == "." || strings.HasPrefix(rel, parent+string(filepath.Separator))
+}
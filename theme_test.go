@@ -0,0 +1,122 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestThemes(test *testing.T) {
+	test.Parallel()
+
+	tdir := filepath.Join(os.TempDir(), "pagr_test", "TestThemes")
+	themesDir := filepath.Join(tdir, "themes")
+	files := map[string]string{
+		"themes/base/templates/default.hmpl":          `<main>{{template "header" .}}{{.Meta.Title}}</main>`,
+		"themes/base/templates/partials/header.hmpl":  `<h1>base</h1>`,
+		"themes/base/templates/shortcodes/note.hmpl":  `base note`,
+		"themes/base/assets/style.css":                `base`,
+		"themes/base/assets/logo.svg":                 `<svg/>`,
+		"themes/base/assets/main.scss":                `a { color: red; }`,
+		"themes/base/assets/_vars.scss":               `$fg: red;`,
+		"themes/base/defaults.json":                   `{"author": "base", "lang": "en"}`,
+		"themes/fancy/templates/partials/header.hmpl": `<h1>fancy</h1>`,
+		"themes/fancy/defaults.json":                  `{"author": "fancy"}`,
+		"templates/shortcodes/note.hmpl":              `own note`,
+		"assets/style.css":                            `own`,
+		"assets/main.css":                             `own`,
+		"assets/_vars.css":                            `own`,
+		"content/index.md":                            `home`,
+		"content/post/index.md":                       `post`,
+		"content/post/meta.json":                      `{"Draft": false}`,
+	}
+	for fname, data := range files {
+		fpath := filepath.Join(tdir, fname)
+		if err := os.MkdirAll(filepath.Dir(fpath), 0775); err != nil {
+			test.Fatal("setup failed:", err)
+		}
+		if err := ioutil.WriteFile(fpath, []byte(data), 0644); err != nil {
+			test.Fatal("setup failed:", err)
+		}
+	}
+
+	if _, err := LoadThemes(themesDir, []string{"missing"}); err == nil {
+		test.Error("LoadThemes didn't fail for a missing theme")
+	}
+	themes, err := LoadThemes(themesDir, []string{"fancy", "base"})
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	// theme Meta is applied before drafts are skipped
+	draft := Theme{Name: "draft", Meta: Meta{"Draft": true}}
+	if pages, err := LoadContentDir(filepath.Join(tdir, "content"), draft); err != nil {
+		test.Error(err)
+	} else if len(pages) != 1 || pages[0].Path != "/post" {
+		test.Errorf("LoadContentDir didn't skip the pages that are drafts by the theme Meta: %v", pages)
+	}
+
+	templateDirs := themePaths(themes, themeTemplatesDir, filepath.Join(tdir, "templates"))
+	expect := []string{
+		filepath.Join(themesDir, "base", "templates"),
+		filepath.Join(themesDir, "fancy", "templates"),
+		filepath.Join(tdir, "templates"),
+	}
+	if len(templateDirs) != len(expect) {
+		test.Fatalf("themePaths returned %v (should be %v)", templateDirs, expect)
+	}
+	for i := range expect {
+		if templateDirs[i] != expect[i] {
+			test.Fatalf("themePaths returned %v (should be %v)", templateDirs, expect)
+		}
+	}
+
+	pages := []Page{NewPage("/", time.Now())}
+	pages[0].Meta["lang"] = "fr"
+	ApplyThemeMeta(pages, themes)
+	if pages[0].Meta["author"] != "fancy" || pages[0].Meta["lang"] != "fr" {
+		test.Errorf("invalid page Meta after ApplyThemeMeta: %v", pages[0].Meta)
+	}
+
+	templates, err := LoadTemplateDir(templateDirs...)
+	if err != nil {
+		test.Fatal(err)
+	} else if len(templates) != 1 {
+		test.Fatalf("LoadTemplateDir loaded %d templates (should be 1)", len(templates))
+	}
+	buf, err := templates[0].Execute(pages[0])
+	if err != nil {
+		test.Fatal(err)
+	} else if buf.String() != "<main><h1>fancy</h1>Home</main>" {
+		test.Errorf("invalid theme template output: '%s'", buf.String())
+	}
+
+	set, err := LoadShortcodeDir(joinPaths(templateDirs, shortcodesDir)...)
+	if err != nil {
+		test.Fatal(err)
+	}
+	note := set["note"]
+	if buf, err = note.Execute(nil); err != nil || buf.String() != "own note" {
+		test.Errorf("project shortcode didn't override the theme shortcode: '%s' (%v)", buf.String(), err)
+	}
+
+	assetDirs := themePaths(themes, themeAssetsDir, filepath.Join(tdir, "assets"))
+	pps := []Preprocessor{{Ext: ".scss", OutExt: ".css"}}
+	outputs := []map[string]bool{assetOutputs(assetDirs[1], pps)}
+	if !overridden("style.css", outputs) || overridden("logo.svg", outputs) {
+		test.Error("invalid theme asset overrides")
+	}
+	if !overridden(assetOutput("main.scss", pps), outputs) {
+		test.Error("project asset didn't override the preprocessed theme asset with the same output path")
+	}
+	base := assetOutputs(assetDirs[0], pps)
+	if !base["main.css"] || base["main.scss"] || base["_vars.css"] {
+		test.Errorf("invalid assetOutputs: %v", base)
+	}
+
+	if err = os.RemoveAll(tdir); err != nil {
+		test.Error(err)
+	}
+}